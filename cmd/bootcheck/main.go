@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ppopth/discv5-tools/health"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+var (
+	bootnodesFlag  = flag.String("bootnodes", "", "Comma separated nodes to check (the default boot nodes if empty)")
+	minFlag        = flag.Int("min", 1, "Exit with a non-zero code if fewer boot nodes than this are healthy")
+	protocolIDFlag = flag.String("protocol-id", "discv5", "The protocol ID in the packet headers")
+)
+
+func main() {
+	flag.Parse()
+
+	var bootUrls []string
+	if *bootnodesFlag != "" {
+		bootUrls = strings.Split(*bootnodesFlag, ",")
+	} else {
+		bootUrls = params.V5Bootnodes
+	}
+	var bootNodes []*enode.Node
+	for _, url := range bootUrls {
+		bootNodes = append(bootNodes, enode.MustParse(url))
+	}
+
+	protocolID, err := wire.ParseProtocolID(*protocolIDFlag)
+	if err != nil {
+		log.Fatalf("invalid protocol ID: %v", err)
+	}
+	statuses, err := health.CheckAllProtocol(bootNodes, protocolID)
+	if err != nil {
+		log.Fatalf("the boot nodes cannot be checked: %v", err)
+	}
+	healthy := 0
+	for _, s := range statuses {
+		verdict := "unhealthy"
+		if s.Healthy() {
+			verdict = "healthy"
+			healthy++
+		}
+		fmt.Printf("%s: %v\n", verdict, s)
+	}
+	fmt.Printf("%d of %d boot nodes are healthy\n", healthy, len(statuses))
+	if healthy < *minFlag {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/conformance"
+)
+
+var (
+	enrFlag     = flag.String("enr", "", "The ENR of the node you want to test")
+	casesFlag   = flag.String("cases", "", "Comma separated names of the cases to run (all if empty)")
+	timeoutFlag = flag.Duration("timeout", 1*time.Second, "The time to wait for responses after each case")
+	jsonFlag    = flag.Bool("json", false, "Print the results as JSON")
+	listFlag    = flag.Bool("list", false, "List the cases and exit")
+)
+
+type resultJson struct {
+	Case       string
+	Expect     string
+	Responses  []string
+	Alive      bool
+	Conforming bool
+	Error      string `json:",omitempty"`
+}
+
+func main() {
+	flag.Parse()
+	if *listFlag {
+		for _, c := range conformance.Cases {
+			fmt.Printf("%-28s expect=%v\n", c.Name, c.Expect)
+		}
+		return
+	}
+	if *enrFlag == "" {
+		log.Fatal("please provide the ENR of the node you want to test")
+	}
+	nd := enode.MustParse(*enrFlag)
+
+	cases := conformance.Cases
+	if *casesFlag != "" {
+		cases = nil
+		for _, name := range strings.Split(*casesFlag, ",") {
+			c, ok := conformance.CaseByName(name)
+			if !ok {
+				log.Fatalf("unknown case: %v", name)
+			}
+			cases = append(cases, c)
+		}
+	}
+
+	var results []resultJson
+	failed := 0
+	for _, c := range cases {
+		r, err := conformance.Run(nd, c, *timeoutFlag)
+		if err != nil {
+			log.Fatalf("the tester cannot be created: %v", err)
+		}
+		if r.Err != nil || !r.Alive || !r.Conforming {
+			failed++
+		}
+		if !*jsonFlag {
+			fmt.Println(r)
+			continue
+		}
+		rj := resultJson{
+			Case:       r.Case,
+			Expect:     c.Expect.String(),
+			Responses:  r.Responses,
+			Alive:      r.Alive,
+			Conforming: r.Conforming,
+		}
+		if r.Err != nil {
+			rj.Error = r.Err.Error()
+		}
+		results = append(results, rj)
+	}
+	if *jsonFlag {
+		text, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatalf("error: marshaling the results: %v", err)
+		}
+		fmt.Println(string(text))
+	} else {
+		fmt.Printf("%d of %d cases passed\n", len(cases)-failed, len(cases))
+	}
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
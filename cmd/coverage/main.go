@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/coverage"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+var (
+	bitsFlag      = flag.Int("bits", 8, "The number of prefix bits used to bin the node IDs")
+	refFlag       = flag.String("ref", "", "The reference node ID of the log distances (the local node ID in the manifest by default)")
+	svgFlag       = flag.String("svg", "", "The file to write the SVG heatmap of the prefix bins to")
+	thresholdFlag = flag.Float64("threshold", 3, "The standardized residual from which a bin is flagged")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <node set file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The node IDs in all the files without duplicates.
+	seen := make(map[enode.ID]bool)
+	var ids []enode.ID
+	for _, file := range flag.Args() {
+		nodes, err := snapshot.ReadFile(file)
+		if err != nil {
+			log.Fatalf("error: reading the node set %v: %v", file, err)
+		}
+		for i := range nodes {
+			nd, err := nodes[i].Node()
+			if err != nil {
+				log.Fatalf("error: reading the node set %v: %v", file, err)
+			}
+			if !seen[nd.ID()] {
+				seen[nd.ID()] = true
+				ids = append(ids, nd.ID())
+			}
+		}
+	}
+	fmt.Printf("nodes: %d\n", len(ids))
+
+	a, err := coverage.ByPrefix(ids, *bitsFlag)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	fmt.Printf("\nprefix bins: %d (%d bits), expected %.2f nodes in each\n", len(a.Bins), *bitsFlag, a.Bins[0].Expected)
+	if a.Bins[0].Expected < 5 {
+		fmt.Println("warning: the chi-square test isn't reliable with fewer than 5 nodes expected in each bin, use fewer -bits")
+	}
+	printAnalysis(a, *bitsFlag)
+	if *svgFlag != "" {
+		f, err := os.Create(*svgFlag)
+		if err != nil {
+			log.Fatalf("error: creating the heatmap: %v", err)
+		}
+		if err := coverage.WriteHeatmap(f, a, *bitsFlag, *thresholdFlag); err != nil {
+			log.Fatalf("error: writing the heatmap: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error: writing the heatmap: %v", err)
+		}
+	}
+
+	ref, ok := reference()
+	if !ok {
+		return
+	}
+	a = coverage.ByLogDistance(ids, ref)
+	fmt.Printf("\nlog distances to %s:\n", ref)
+	fmt.Printf("  %-9s %9s %9s %9s\n", "distance", "observed", "expected", "residual")
+	for _, b := range a.Bins {
+		fmt.Printf("  %-9s %9d %9.1f %9.2f\n", b.Label(0), b.Observed, b.Expected, b.Residual)
+	}
+	printAnalysis(a, 0)
+}
+
+// reference returns the reference node ID in the option or the manifest of
+// the first file.
+func reference() (enode.ID, bool) {
+	if *refFlag != "" {
+		id, err := enode.ParseID(*refFlag)
+		if err != nil {
+			log.Fatalf("error: invalid reference node ID: %v", err)
+		}
+		return id, true
+	}
+	// Only a crawl has a reference, i.e. the node ID of the crawler. The IDs
+	// of the other runs, e.g. the batch mode of network-measure, are of the
+	// measurement client, which doesn't look up any node.
+	m, err := snapshot.ReadManifest(flag.Arg(0))
+	if err != nil || len(m.BootNodes) == 0 || len(m.LocalIDs) == 0 {
+		return enode.ID{}, false
+	}
+	id, err := enode.ParseID(m.LocalIDs[0])
+	if err != nil {
+		return enode.ID{}, false
+	}
+	return id, true
+}
+
+func printAnalysis(a *coverage.Analysis, bits int) {
+	fmt.Printf("chi-square: %.2f df=%d p=%.4g\n", a.ChiSquare, a.DF, a.P)
+	for _, b := range a.Over(*thresholdFlag) {
+		fmt.Printf("over-populated: %s (%d nodes, %.1f expected, residual %.2f)\n",
+			b.Label(bits), b.Observed, b.Expected, b.Residual)
+	}
+	for _, b := range a.Under(*thresholdFlag) {
+		fmt.Printf("under-populated: %s (%d nodes, %.1f expected, residual %.2f)\n",
+			b.Label(bits), b.Observed, b.Expected, b.Residual)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+var (
+	rttFlag  = flag.Duration("rtt-threshold", snapshot.DefaultRttThreshold, "The smallest RTT change reported")
+	lossFlag = flag.Float64("loss-threshold", snapshot.DefaultLossThreshold, "The smallest loss rate change reported")
+	jsonFlag = flag.Bool("json", false, "Print the differences as JSON")
+	allFlag  = flag.Bool("v", false, "List every change instead of only the counts")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <old node set file> <new node set file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oldNodes, err := snapshot.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("error: reading the node set %v: %v", flag.Arg(0), err)
+	}
+	newNodes, err := snapshot.ReadFile(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("error: reading the node set %v: %v", flag.Arg(1), err)
+	}
+	d, err := snapshot.Compare(oldNodes, newNodes, &snapshot.DiffConfig{
+		RttThreshold:  *rttFlag,
+		LossThreshold: *lossFlag,
+	})
+	if err != nil {
+		log.Fatalf("error: comparing the node sets: %v", err)
+	}
+
+	if *jsonFlag {
+		text, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			log.Fatalf("error: marshaling the differences: %v", err)
+		}
+		fmt.Println(string(text))
+		return
+	}
+	printText(d, len(oldNodes), len(newNodes))
+}
+
+func printText(d *snapshot.Diff, oldLen, newLen int) {
+	fmt.Printf("nodes: %d -> %d (%d in both)\n", oldLen, newLen, d.Common)
+	fmt.Printf("joined: %d\n", len(d.Joined))
+	if *allFlag {
+		for _, id := range d.Joined {
+			fmt.Printf("  + %s\n", id)
+		}
+	}
+	fmt.Printf("left: %d\n", len(d.Left))
+	if *allFlag {
+		for _, id := range d.Left {
+			fmt.Printf("  - %s\n", id)
+		}
+	}
+	fmt.Printf("seq bumps: %d\n", len(d.SeqBumps))
+	if *allFlag {
+		for _, c := range d.SeqBumps {
+			fmt.Printf("  %s %d -> %d\n", c.ID, c.Old, c.New)
+		}
+	}
+	fmt.Printf("endpoint changes: %d\n", len(d.EndpointChanges))
+	if *allFlag {
+		for _, c := range d.EndpointChanges {
+			fmt.Printf("  %s %s -> %s\n", c.ID, c.Old, c.New)
+		}
+	}
+	fmt.Printf("fork digest changes: %d\n", len(d.ForkDigestChanges))
+	if *allFlag {
+		for _, c := range d.ForkDigestChanges {
+			fmt.Printf("  %s %q -> %q\n", c.ID, c.Old, c.New)
+		}
+	}
+	fmt.Printf("rtt changes (>= %v): %d\n", *rttFlag, len(d.RttChanges))
+	if *allFlag {
+		for _, c := range d.RttChanges {
+			fmt.Printf("  %s %v -> %v (%+v)\n", c.ID, c.Old, c.New, c.Delta)
+		}
+	}
+	fmt.Printf("loss changes (>= %v): %d\n", *lossFlag, len(d.LossChanges))
+	if *allFlag {
+		for _, c := range d.LossChanges {
+			fmt.Printf("  %s %.2f -> %.2f (%+.2f)\n", c.ID, c.Old, c.New, c.Delta)
+		}
+	}
+}
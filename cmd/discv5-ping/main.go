@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+var (
+	countFlag      = flag.Int("c", 0, "Stop after sending this many probes (0 means ping until interrupted)")
+	intervalFlag   = flag.Duration("i", 1*time.Second, "The interval between sending each probe")
+	timeoutFlag    = flag.Duration("W", 3*time.Second, "The time to wait for a WHOAREYOU response")
+	protocolIDFlag = flag.String("protocol-id", "discv5", "The protocol ID in the packet headers")
+)
+
+// stats accumulates the round-trip times of the replies.
+type stats struct {
+	sent     int
+	received int
+	min      time.Duration
+	max      time.Duration
+	// The sum and the sum of squares are used to calculate the mean deviation.
+	sum   float64
+	sumSq float64
+}
+
+func (s *stats) add(rtt time.Duration) {
+	if s.received == 0 || rtt < s.min {
+		s.min = rtt
+	}
+	if rtt > s.max {
+		s.max = rtt
+	}
+	s.received++
+	s.sum += float64(rtt)
+	s.sumSq += float64(rtt) * float64(rtt)
+}
+
+func (s *stats) print(nd *enode.Node, elapsed time.Duration) {
+	fmt.Printf("\n--- %s discv5 ping statistics ---\n", nd.ID().TerminalString())
+	loss := 0.0
+	if s.sent != 0 {
+		loss = float64(s.sent-s.received) / float64(s.sent) * 100
+	}
+	fmt.Printf("%d packets transmitted, %d received, %.4g%% packet loss, time %dms\n",
+		s.sent, s.received, loss, elapsed.Milliseconds())
+	if s.received == 0 {
+		return
+	}
+	avg := s.sum / float64(s.received)
+	mdev := math.Sqrt(math.Max(s.sumSq/float64(s.received)-avg*avg, 0))
+	fmt.Printf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n",
+		ms(float64(s.min)), ms(avg), ms(float64(s.max)), ms(mdev))
+}
+
+// ms converts nanoseconds to milliseconds.
+func ms(ns float64) float64 {
+	return ns / float64(time.Millisecond)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] <enr>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *intervalFlag <= 0 || *timeoutFlag <= 0 || *countFlag < 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-i and -W must be positive and -c must not be negative")
+		flag.Usage()
+		os.Exit(2)
+	}
+	nd, err := enode.Parse(enode.ValidSchemes, flag.Arg(0))
+	if err != nil {
+		log.Fatalf("invalid ENR: %v", err)
+	}
+	protocolID, err := wire.ParseProtocolID(*protocolIDFlag)
+	if err != nil {
+		log.Fatalf("invalid protocol ID: %v", err)
+	}
+
+	// The interval between the probes is set by the -i option.
+	client, err := measure.Listen(&measure.Config{NodeInterval: -1, ProtocolID: protocolID})
+	if err != nil {
+		log.Fatalf("the measurement client cannot be created: %v", err)
+	}
+	defer client.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	fmt.Printf("DISCV5-PING %s (%v:%d)\n", nd.ID().TerminalString(), nd.IP(), nd.UDP())
+	var s stats
+	start := time.Now()
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+loop:
+	for seq := 1; *countFlag == 0 || seq <= *countFlag; seq++ {
+		s.sent++
+		resp, rtt, err := client.ProbeTimeout(nd, *timeoutFlag)
+		if err == measure.ErrTimeout {
+			fmt.Printf("no reply from %v:%d: seq=%d\n", nd.IP(), nd.UDP(), seq)
+		} else if err != nil {
+			log.Fatalf("error: %v", err)
+		} else {
+			s.add(rtt)
+			fmt.Printf("reply from %v: seq=%d nonce=%s record-seq=%d time=%.3f ms\n",
+				resp.From, seq, hex.EncodeToString(resp.Header.Nonce[:]), resp.RecordSeq, ms(float64(rtt)))
+		}
+		if *countFlag != 0 && seq == *countFlag {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			break loop
+		}
+	}
+	s.print(nd, time.Since(start))
+	if s.received == 0 {
+		os.Exit(1)
+	}
+}
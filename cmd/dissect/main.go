@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ppopth/discv5-tools/pcap"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+var (
+	fileFlag    = flag.String("file", "", "The pcap or pcapng file to read")
+	idsFlag     = flag.String("ids", "", "Comma separated node IDs or ENRs of the destination nodes")
+	keysFlag    = flag.String("keys", "", "Comma separated <source node ID>:<hex key> used to decrypt messages")
+	portFlag    = flag.Int("port", 0, "Only show packets from or to this UDP port")
+	verboseFlag = flag.Bool("v", false, "Also show UDP packets which can't be unmasked")
+)
+
+func main() {
+	flag.Parse()
+	if *fileFlag == "" || *idsFlag == "" {
+		log.Fatal("please provide the pcap file and the destination node IDs")
+	}
+	ids, err := parseIDs(*idsFlag)
+	if err != nil {
+		log.Fatalf("invalid node ID: %v", err)
+	}
+	keys, err := parseKeys(*keysFlag)
+	if err != nil {
+		log.Fatalf("invalid key: %v", err)
+	}
+
+	f, err := os.Open(*fileFlag)
+	if err != nil {
+		log.Fatalf("error: opening a file: %v", err)
+	}
+	defer f.Close()
+	rd, err := pcap.NewReader(f)
+	if err != nil {
+		log.Fatalf("error: reading the pcap file: %v", err)
+	}
+
+	for num := 1; ; num++ {
+		p, err := rd.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Fatalf("error: reading the pcap file: %v", err)
+		}
+		udp, ok := p.DecodeUDP()
+		if !ok {
+			continue
+		}
+		if *portFlag != 0 && udp.Src.Port != *portFlag && udp.Dst.Port != *portFlag {
+			continue
+		}
+		summary := fmt.Sprintf("#%d %s %v -> %v len=%d", num, p.Time.Format("2006-01-02 15:04:05.000000"), udp.Src, udp.Dst, len(udp.Payload))
+
+		// We don't know which node the packet is sent to, so try every ID.
+		var (
+			head    *v5wire.Header
+			msgData []byte
+			dstID   enode.ID
+		)
+		for _, id := range ids {
+			// The packet is unmasked in place, so decode a copy.
+			payload := append([]byte{}, udp.Payload...)
+			if head, msgData, err = wire.DecodeRawPacket(payload, id); err == nil {
+				dstID = id
+				break
+			}
+		}
+		if head == nil {
+			if *verboseFlag {
+				fmt.Printf("%s\n    not a discv5 packet to any of the given nodes\n\n", summary)
+			}
+			continue
+		}
+		fmt.Println(summary)
+		dissect(head, msgData, dstID, keys)
+		fmt.Println()
+	}
+}
+
+func dissect(head *v5wire.Header, msgData []byte, dstID enode.ID, keys map[enode.ID][]byte) {
+	flag := fmt.Sprintf("%s (%d)", wire.FlagName(head.Flag), head.Flag)
+	fmt.Printf("    Destination ID: %s\n", dstID)
+	fmt.Printf("    Masking IV: %s\n", hex.EncodeToString(head.IV[:]))
+	fmt.Printf("    Protocol ID: %s, Version: %d, Flag: %s\n", head.ProtocolID[:], head.Version, flag)
+	fmt.Printf("    Nonce: %s\n", hex.EncodeToString(head.Nonce[:]))
+	fmt.Printf("    Auth size: %d\n", head.AuthSize)
+
+	var srcID enode.ID
+	if auth, err := wire.DecodeWhoareyouAuthData(head); err == nil {
+		fmt.Printf("    ID nonce: %s\n", hex.EncodeToString(auth.IDNonce[:]))
+		fmt.Printf("    Record seq: %d\n", auth.RecordSeq)
+	} else if auth, err := wire.DecodeMessageAuthData(head); err == nil {
+		srcID = auth.SrcID
+		fmt.Printf("    Source ID: %s\n", srcID)
+	} else if auth, err := wire.DecodeHandshakeAuthData(head); err == nil {
+		srcID = auth.SrcID
+		fmt.Printf("    Source ID: %s\n", srcID)
+		fmt.Printf("    ID signature (%d bytes): %s\n", len(auth.Signature), hex.EncodeToString(auth.Signature))
+		fmt.Printf("    Ephemeral public key (%d bytes): %s\n", len(auth.Pubkey), hex.EncodeToString(auth.Pubkey))
+		if len(auth.Record) == 0 {
+			fmt.Printf("    Record: none\n")
+		} else {
+			var r enr.Record
+			if err := rlp.DecodeBytes(auth.Record, &r); err != nil {
+				fmt.Printf("    Record (%d bytes): invalid: %v\n", len(auth.Record), err)
+			} else if nd, err := enode.New(enode.ValidSchemes, &r); err != nil {
+				fmt.Printf("    Record (%d bytes): invalid: %v\n", len(auth.Record), err)
+			} else {
+				fmt.Printf("    Record (%d bytes): %s\n", len(auth.Record), nd)
+			}
+		}
+	} else {
+		fmt.Printf("    Auth data: %s (%v)\n", hex.EncodeToString(head.AuthData), err)
+	}
+	fmt.Printf("    Message: %d bytes\n", len(msgData))
+
+	key, ok := keys[srcID]
+	if len(msgData) == 0 || !ok {
+		return
+	}
+	msg, err := wire.DecryptMessage(head, msgData, key)
+	if err != nil {
+		fmt.Printf("    Decrypted message: error: %v\n", err)
+		return
+	}
+	fmt.Printf("    Decrypted message: %s %s\n", msg.Name(), formatMessage(msg))
+}
+
+func formatMessage(msg v5wire.Packet) string {
+	switch msg := msg.(type) {
+	case *v5wire.Nodes:
+		var urls []string
+		for _, r := range msg.Nodes {
+			if nd, err := enode.New(enode.ValidSchemes, r); err == nil {
+				urls = append(urls, nd.String())
+			}
+		}
+		return fmt.Sprintf("{ReqID:%x Total:%d Nodes:[%s]}", msg.ReqID, msg.Total, strings.Join(urls, " "))
+	default:
+		return fmt.Sprintf("%+v", msg)
+	}
+}
+
+// parseIDs parses the comma separated list of node IDs or node URLs.
+func parseIDs(s string) ([]enode.ID, error) {
+	var ids []enode.ID
+	for _, str := range strings.Split(s, ",") {
+		if strings.HasPrefix(str, "enr:") || strings.HasPrefix(str, "enode:") {
+			nd, err := enode.Parse(enode.ValidSchemes, str)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, nd.ID())
+			continue
+		}
+		id, err := enode.ParseID(str)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseKeys parses the comma separated list of <source node ID>:<hex key>.
+// The key of a node is the key used to encrypt the messages from it.
+func parseKeys(s string) (map[enode.ID][]byte, error) {
+	keys := make(map[enode.ID][]byte)
+	if s == "" {
+		return keys, nil
+	}
+	for _, str := range strings.Split(s, ",") {
+		parts := strings.SplitN(str, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing colon in %q", str)
+		}
+		id, err := enode.ParseID(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(parts[1], "0x"))
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, fmt.Errorf("the key of %s is not 16 bytes", id.TerminalString())
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/fingerprint"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+var (
+	enrFlag         = flag.String("enr", "", "The ENR of the node you want to fingerprint")
+	fileFlag        = flag.String("file", "", "The node set file of network-measure used for the census")
+	concurrencyFlag = flag.Int("concurrency", 16, "The number of nodes fingerprinted at the same time")
+	verboseFlag     = flag.Bool("v", false, "Print the observed traits of each node")
+)
+
+func main() {
+	flag.Parse()
+	if *concurrencyFlag < 1 {
+		log.Fatal("-concurrency must be at least 1")
+	}
+
+	var nodes []*enode.Node
+	switch {
+	case *enrFlag != "":
+		nodes = append(nodes, enode.MustParse(*enrFlag))
+	case *fileFlag != "":
+		entries, err := snapshot.ReadFile(*fileFlag)
+		if err != nil {
+			log.Fatalf("error: reading the node set: %v", err)
+		}
+		for _, e := range entries {
+			nd, err := e.Node()
+			if err != nil {
+				log.Fatalf("error: parsing a node: %v", err)
+			}
+			nodes = append(nodes, nd)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Either -enr or -file is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	prober, err := fingerprint.NewProber()
+	if err != nil {
+		log.Fatalf("error: creating the prober: %v", err)
+	}
+	defer prober.Close()
+
+	var (
+		lock sync.Mutex
+		fps  []*fingerprint.Fingerprint
+		wg   sync.WaitGroup
+	)
+	// This semaphore is used to limit the number of concurrent probes.
+	semaphore := make(chan interface{}, *concurrencyFlag)
+	for _, nd := range nodes {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(nd *enode.Node) {
+			defer wg.Done()
+			fp := prober.Fingerprint(nd)
+			<-semaphore
+
+			lock.Lock()
+			defer lock.Unlock()
+			fps = append(fps, fp)
+			fmt.Println(fp)
+			if *verboseFlag {
+				text, _ := json.Marshal(fp.Traits)
+				fmt.Printf("  traits=%s\n", text)
+			}
+		}(nd)
+	}
+	wg.Wait()
+
+	if len(nodes) > 1 {
+		census := fingerprint.NewCensus(fps)
+		fmt.Printf("census of %d nodes:\n", len(fps))
+		for _, client := range census.Clients() {
+			fmt.Printf("  %-10s %5d (%.1f%%)\n", client, census[client], 100*float64(census[client])/float64(len(fps)))
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+)
+
+// tapConn is a UDP connection which reports every packet read from it before
+// it's handled by the discv5 node, and every packet written to it.
+type tapConn struct {
+	*net.UDPConn
+	tap    func(b []byte, addr *net.UDPAddr)
+	tapOut func(b []byte, addr *net.UDPAddr)
+}
+
+func (c *tapConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	n, addr, err := c.UDPConn.ReadFromUDP(b)
+	if err == nil {
+		// Copy the packet, because the node will unmask it in place.
+		packet := make([]byte, n)
+		copy(packet, b[:n])
+		c.tap(packet, addr)
+	}
+	return n, addr, err
+}
+
+func (c *tapConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	// Copy the packet, because it's unmasked in place when it's decoded.
+	packet := make([]byte, len(b))
+	copy(packet, b)
+	c.tapOut(packet, addr)
+	return c.UDPConn.WriteToUDP(b, addr)
+}
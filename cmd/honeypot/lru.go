@@ -0,0 +1,75 @@
+package main
+
+import (
+	"container/list"
+)
+
+// lru is a map which keeps at most size entries. When it's full, the least
+// recently used entry is evicted, so that the packets from random IDs or
+// addresses can't exhaust the memory.
+type lru struct {
+	size  int
+	ll    *list.List
+	items map[interface{}]*list.Element
+	// The number of entries evicted.
+	evicted int
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[interface{}]*list.Element),
+	}
+}
+
+// get returns the value of the key and marks it as recently used.
+func (c *lru) get(key interface{}) (interface{}, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+// add sets the value of the key and marks it as recently used.
+func (c *lru) add(key, value interface{}) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key, value})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+		c.evicted++
+	}
+}
+
+func (c *lru) remove(key interface{}) {
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
+
+// values returns the values from the most recently used one.
+func (c *lru) values() []interface{} {
+	values := make([]interface{}, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		values = append(values, el.Value.(*lruEntry).value)
+	}
+	return values
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	bootnodesFlag = flag.String("bootnodes", "", "Comma separated nodes used for bootstrapping")
+	keyFlag       = flag.String("key", "", "The file of the private key (generated if it doesn't exist)")
+	addrFlag      = flag.String("addr", "0.0.0.0:9000", "The UDP address to listen on")
+	extipFlag     = flag.String("extip", "", "The external IP address advertised in the ENR")
+	statsFlag     = flag.String("stats", "", "The file to save the statistics to")
+	announceFlag  = flag.Bool("announce", true, "Keep doing lookups, so that more nodes learn about us")
+	quietFlag     = flag.Bool("quiet", false, "Don't log every inbound packet")
+)
+
+var (
+	// The mutex used to access the stats in multiple routines.
+	lock sync.Mutex
+	st   *stats
+)
+
+func main() {
+	flag.Parse()
+	log.Print("started discv5-tools/honeypot")
+
+	var bootUrls []string
+	if *bootnodesFlag != "" {
+		bootUrls = strings.Split(*bootnodesFlag, ",")
+	} else {
+		bootUrls = params.V5Bootnodes
+	}
+	var bootNodes []*enode.Node
+	for _, url := range bootUrls {
+		bootNodes = append(bootNodes, enode.MustParse(url))
+	}
+
+	privateKey, err := loadKey(*keyFlag)
+	if err != nil {
+		log.Fatalf("the private key cannot be loaded: %v", err)
+	}
+	// By putting the empty string, it will create a memory database instead
+	// of a persistent database.
+	db, err := enode.OpenDB("")
+	if err != nil {
+		log.Fatalf("the node database cannot be created: %v", err)
+	}
+	ln := enode.NewLocalNode(db, privateKey)
+
+	laddr, err := net.ResolveUDPAddr("udp4", *addrFlag)
+	if err != nil {
+		log.Fatalf("invalid address: %v", err)
+	}
+	socket, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		log.Fatalf("cannot listen on %v: %v", laddr, err)
+	}
+	uaddr := socket.LocalAddr().(*net.UDPAddr)
+	if *extipFlag != "" {
+		ip := net.ParseIP(*extipFlag)
+		if ip == nil {
+			log.Fatalf("invalid external IP: %v", *extipFlag)
+		}
+		ln.SetStaticIP(ip)
+	} else if uaddr.IP.IsUnspecified() {
+		ln.SetFallbackIP(net.IP{127, 0, 0, 1})
+	} else {
+		ln.SetFallbackIP(uaddr.IP)
+	}
+	ln.SetFallbackUDP(uaddr.Port)
+
+	st = newStats(log.New(os.Stderr, "honeypot: ", log.LstdFlags|log.Lmsgprefix), !*quietFlag, privateKey)
+	conn := &tapConn{
+		UDPConn: socket,
+		tap: func(b []byte, addr *net.UDPAddr) {
+			lock.Lock()
+			defer lock.Unlock()
+			st.add(b, addr)
+		},
+		tapOut: func(b []byte, addr *net.UDPAddr) {
+			lock.Lock()
+			defer lock.Unlock()
+			st.sent(b, addr)
+		},
+	}
+	disc, err := discover.ListenV5(conn, ln, discover.Config{
+		PrivateKey: privateKey,
+		Bootnodes:  bootNodes,
+	})
+	if err != nil {
+		log.Fatalf("the discv5 node cannot be started: %v", err)
+	}
+	defer disc.Close()
+	log.Printf("listening on %v as %v", uaddr, disc.Self())
+
+	if *announceFlag {
+		go announce(disc)
+	}
+	if *statsFlag != "" {
+		go autosave(*statsFlag)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	lock.Lock()
+	defer lock.Unlock()
+	log.Printf("stopped %v", st)
+	if *statsFlag != "" {
+		save(*statsFlag)
+	}
+}
+
+// loadKey loads the private key from the file. If the file doesn't exist, a
+// new key is generated and saved to the file. If the file name is empty, a
+// new key is generated every time.
+func loadKey(file string) (*ecdsa.PrivateKey, error) {
+	if file == "" {
+		return crypto.GenerateKey()
+	}
+	key, err := crypto.LoadECDSA(file)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err = crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := crypto.SaveECDSA(file, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// announce keeps doing lookups. Every node contacted in the lookups learns
+// about us and may add us to its table.
+func announce(disc *discover.UDPv5) {
+	iter := disc.RandomNodes()
+	defer iter.Close()
+	for iter.Next() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func autosave(file string) {
+	c := time.Tick(1 * time.Minute)
+	for range c {
+		lock.Lock()
+		save(file)
+		log.Printf("saved %v", st)
+		lock.Unlock()
+	}
+}
+
+func save(file string) {
+	text, err := json.Marshal(st)
+	if err != nil {
+		log.Fatalf("error: marshaling the statistics: %v", err)
+	}
+	if err := os.WriteFile(file, text, 0644); err != nil {
+		log.Fatalf("error: writing the statistics to the file: %v", err)
+	}
+}
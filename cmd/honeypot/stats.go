@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+// The limits of the state kept by the statistics. Anyone can send packets
+// from random IDs and addresses, so the least recently seen ones are evicted
+// when the limits are reached.
+const (
+	maxPeers = 50000
+	// The addresses of the nodes which our packets are masked with.
+	maxAddrs = 50000
+	// The pending WHOAREYOU challenges and the established sessions.
+	maxChallenges = 10000
+	maxSessions   = 10000
+	// The addresses counted for each peer. The other addresses are counted
+	// as otherAddr.
+	maxPeerAddrs = 16
+	otherAddr    = "other"
+	// The largest distance which can be asked in a FINDNODE request. The
+	// other distances are counted as invalidDistances.
+	maxDistance = 256
+)
+
+// peer is the statistics of the packets claiming to be from the same node.
+type peer struct {
+	id enode.ID
+	// The latest record sent in a handshake, if any.
+	nd      *enode.Node
+	addrs   map[string]int
+	packets map[string]int
+	// The decrypted messages by name and the FINDNODE requests by distance.
+	messages  map[string]int
+	distances map[uint]int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type stats struct {
+	start   time.Time
+	total   int
+	invalid int
+	byFlag  map[string]int
+	// The decrypted messages by name, the FINDNODE requests by distance and
+	// the number of message packets which can't be decrypted.
+	messages         map[string]int
+	distances        map[uint]int
+	invalidDistances int
+	undecrypted      int
+	// The peers by ID.
+	peers *lru
+	log   *log.Logger
+	// If it's true, every packet is logged.
+	verbose bool
+
+	// The local key, which is needed to derive the session keys.
+	key     *ecdsa.PrivateKey
+	localID enode.ID
+	// The node last seen at each address, which our packets to the address
+	// are masked with.
+	idByAddr *lru
+	// The header data of the WHOAREYOU packets we sent to the nodes by ID,
+	// which their handshakes answer.
+	challenges *lru
+	// The keys of the sessions the nodes established with us by ID.
+	sessions *lru
+}
+
+func newStats(logger *log.Logger, verbose bool, key *ecdsa.PrivateKey) *stats {
+	return &stats{
+		start:      time.Now(),
+		byFlag:     make(map[string]int),
+		messages:   make(map[string]int),
+		distances:  make(map[uint]int),
+		peers:      newLRU(maxPeers),
+		log:        logger,
+		verbose:    verbose,
+		key:        key,
+		localID:    enode.PubkeyToIDV4(&key.PublicKey),
+		idByAddr:   newLRU(maxAddrs),
+		challenges: newLRU(maxChallenges),
+		sessions:   newLRU(maxSessions),
+	}
+}
+
+// sent records the WHOAREYOU packet sent by the local node to the address,
+// so that the handshake answering it can be decrypted.
+func (s *stats) sent(packet []byte, addr *net.UDPAddr) {
+	v, ok := s.idByAddr.get(addr.String())
+	if !ok {
+		return
+	}
+	id := v.(enode.ID)
+	head, _, err := wire.DecodeRawPacket(packet, id)
+	if err != nil || head.Flag != wire.FlagWhoareyou {
+		return
+	}
+	s.challenges.add(id, wire.HeaderData(head))
+}
+
+// add records the packet sent to the local node from the address.
+func (s *stats) add(packet []byte, addr *net.UDPAddr) {
+	s.total++
+	head, msgData, err := wire.DecodeRawPacket(packet, s.localID)
+	if err != nil {
+		s.invalid++
+		if s.verbose {
+			s.log.Printf("invalid packet from=%v size=%d error=%q", addr, len(packet), err)
+		}
+		return
+	}
+	flag := wire.FlagName(head.Flag)
+	s.byFlag[flag]++
+
+	// WHOAREYOU packets don't contain the source ID.
+	var (
+		srcID  enode.ID
+		record []byte
+	)
+	if auth, err := wire.DecodeMessageAuthData(head); err == nil {
+		srcID = auth.SrcID
+	} else if auth, err := wire.DecodeHandshakeAuthData(head); err == nil {
+		srcID = auth.SrcID
+		record = auth.Record
+		s.handshake(&auth)
+	} else {
+		if s.verbose {
+			s.log.Printf("packet from=%v flag=%s nonce=%s size=%d", addr, flag, hex.EncodeToString(head.Nonce[:]), len(packet))
+		}
+		return
+	}
+	s.idByAddr.add(addr.String(), srcID)
+	msg := s.decrypt(srcID, head, msgData)
+	if s.verbose {
+		s.log.Printf("packet from=%v flag=%s id=%s nonce=%s size=%d%s", addr, flag, srcID.TerminalString(), hex.EncodeToString(head.Nonce[:]), len(packet), describe(msg))
+	}
+
+	var p *peer
+	if v, ok := s.peers.get(srcID); ok {
+		p = v.(*peer)
+	} else {
+		p = &peer{
+			id:        srcID,
+			addrs:     make(map[string]int),
+			packets:   make(map[string]int),
+			messages:  make(map[string]int),
+			distances: make(map[uint]int),
+			firstSeen: time.Now(),
+		}
+		s.peers.add(srcID, p)
+	}
+	if a := addr.String(); p.addrs[a] > 0 || len(p.addrs) < maxPeerAddrs {
+		p.addrs[a]++
+	} else {
+		p.addrs[otherAddr]++
+	}
+	p.packets[flag]++
+	if msg != nil {
+		name := messageName(msg)
+		s.messages[name]++
+		p.messages[name]++
+		if findnode, ok := msg.(*v5wire.Findnode); ok {
+			for _, d := range findnode.Distances {
+				if d > maxDistance {
+					s.invalidDistances++
+					continue
+				}
+				s.distances[d]++
+				p.distances[d]++
+			}
+		}
+	}
+	p.lastSeen = time.Now()
+	if nd := decodeRecord(record, srcID); nd != nil && (p.nd == nil || nd.Seq() > p.nd.Seq()) {
+		p.nd = nd
+	}
+}
+
+// handshake establishes the session which the node starts with the
+// handshake. The WHOAREYOU packet the handshake answers must have been seen.
+func (s *stats) handshake(auth *wire.HandshakeAuthData) {
+	challenge, ok := s.challenges.get(auth.SrcID)
+	if !ok {
+		return
+	}
+	s.challenges.remove(auth.SrcID)
+	keys, err := wire.RecipientKeys(s.key, s.localID, auth, challenge.([]byte))
+	if err != nil {
+		return
+	}
+	s.sessions.add(auth.SrcID, keys)
+}
+
+// decrypt decrypts the message of the packet with the session the node
+// established with us. It returns nil if the message can't be decrypted,
+// e.g. when the session was started by us, because we don't know the keys
+// the discv5 node derived for it.
+func (s *stats) decrypt(id enode.ID, head *v5wire.Header, msgData []byte) v5wire.Packet {
+	if keys, ok := s.sessions.get(id); ok {
+		if msg, err := wire.DecryptMessage(head, msgData, keys.(*wire.SessionKeys).ReadKey); err == nil {
+			return msg
+		}
+	}
+	s.undecrypted++
+	return nil
+}
+
+// messageName returns the name of the message in lower case, e.g. findnode.
+func messageName(msg v5wire.Packet) string {
+	return strings.ToLower(strings.TrimSuffix(msg.Name(), "/v5"))
+}
+
+// describe returns the message in the log line of the packet.
+func describe(msg v5wire.Packet) string {
+	switch msg := msg.(type) {
+	case nil:
+		return ""
+	case *v5wire.Findnode:
+		return fmt.Sprintf(" msg=%s distances=%v", messageName(msg), msg.Distances)
+	default:
+		return fmt.Sprintf(" msg=%s", messageName(msg))
+	}
+}
+
+// decodeRecord decodes the record sent in a handshake. It returns nil if
+// there is no valid record of the node.
+func decodeRecord(b []byte, id enode.ID) *enode.Node {
+	if len(b) == 0 {
+		return nil
+	}
+	var r enr.Record
+	if err := rlp.DecodeBytes(b, &r); err != nil {
+		return nil
+	}
+	nd, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil || nd.ID() != id {
+		return nil
+	}
+	return nd
+}
+
+func (s *stats) String() string {
+	return fmt.Sprintf("packets=%d invalid=%d peers=%d evicted-peers=%d findnode=%d ping=%d undecrypted=%d",
+		s.total, s.invalid, s.peers.len(), s.peers.evicted, s.messages["findnode"], s.messages["ping"], s.undecrypted)
+}
+
+type peerJson struct {
+	ID        string
+	NodeUrl   string `json:",omitempty"`
+	Addrs     map[string]int
+	Packets   map[string]int
+	Messages  map[string]int
+	Distances map[uint]int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+type statsJson struct {
+	Since     time.Time
+	Total     int
+	Invalid   int
+	ByFlag    map[string]int
+	Messages  map[string]int
+	Distances map[uint]int
+	// The distances in the FINDNODE requests larger than 256.
+	InvalidDistances int
+	Undecrypted      int
+	// The number of entries evicted from the state by kind, e.g. the peers
+	// whose statistics are dropped.
+	Evicted map[string]int
+	Peers   []peerJson
+}
+
+func (s *stats) MarshalJSON() ([]byte, error) {
+	sj := statsJson{
+		Since:            s.start,
+		Total:            s.total,
+		Invalid:          s.invalid,
+		ByFlag:           s.byFlag,
+		Messages:         s.messages,
+		Distances:        s.distances,
+		InvalidDistances: s.invalidDistances,
+		Undecrypted:      s.undecrypted,
+		Evicted: map[string]int{
+			"peers":      s.peers.evicted,
+			"addrs":      s.idByAddr.evicted,
+			"challenges": s.challenges.evicted,
+			"sessions":   s.sessions.evicted,
+		},
+		Peers: []peerJson{},
+	}
+	for _, v := range s.peers.values() {
+		p := v.(*peer)
+		pj := peerJson{
+			ID:        p.id.String(),
+			Addrs:     p.addrs,
+			Packets:   p.packets,
+			Messages:  p.messages,
+			Distances: p.distances,
+			FirstSeen: p.firstSeen,
+			LastSeen:  p.lastSeen,
+		}
+		if p.nd != nil {
+			pj.NodeUrl = p.nd.String()
+		}
+		sj.Peers = append(sj.Peers, pj)
+	}
+	// The most active peers come first.
+	sort.Slice(sj.Peers, func(i, j int) bool {
+		return count(sj.Peers[i].Packets) > count(sj.Peers[j].Packets)
+	})
+	return json.Marshal(sj)
+}
+
+func count(m map[string]int) int {
+	n := 0
+	for _, c := range m {
+		n += c
+	}
+	return n
+}
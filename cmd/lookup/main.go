@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ppopth/discv5-tools/session"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+var (
+	bootnodesFlag  = flag.String("bootnodes", "", "Comma separated nodes used for bootstrapping")
+	targetFlag     = flag.String("target", "", "The node ID, public key or ENR to look up (random if empty)")
+	jsonFlag       = flag.Bool("json", false, "Print the lookup trace as JSON")
+	timeoutFlag    = flag.Duration("timeout", 1*time.Second, "The time to wait for each response")
+	protocolIDFlag = flag.String("protocol-id", "discv5", "The protocol ID in the packet headers")
+)
+
+type queryJson struct {
+	NodeUrl   string
+	ID        string
+	Distances []uint
+	Found     []string
+	Latency   time.Duration
+	Elapsed   time.Duration
+	Error     string `json:",omitempty"`
+	Closest   int
+}
+
+type traceJson struct {
+	Target  string
+	Queries []queryJson
+	Result  []string
+}
+
+func main() {
+	flag.Parse()
+
+	var bootUrls []string
+	if *bootnodesFlag != "" {
+		bootUrls = strings.Split(*bootnodesFlag, ",")
+	} else {
+		bootUrls = params.V5Bootnodes
+	}
+	var bootNodes []*enode.Node
+	for _, url := range bootUrls {
+		bootNodes = append(bootNodes, enode.MustParse(url))
+	}
+
+	target, err := parseTarget(*targetFlag)
+	if err != nil {
+		log.Fatalf("invalid target: %v", err)
+	}
+
+	protocolID, err := wire.ParseProtocolID(*protocolIDFlag)
+	if err != nil {
+		log.Fatalf("invalid protocol ID: %v", err)
+	}
+	client, err := session.Listen(&session.Config{Timeout: *timeoutFlag, ProtocolID: protocolID})
+	if err != nil {
+		log.Fatalf("the client cannot be created: %v", err)
+	}
+	defer client.Close()
+
+	trace := traceJson{Target: target.String(), Queries: []queryJson{}}
+	if !*jsonFlag {
+		fmt.Printf("lookup target=%s local=%s\n", target, client.Self().ID().TerminalString())
+	}
+	result := client.Lookup(target, bootNodes, func(q *session.Query) {
+		qj := queryJson{
+			NodeUrl:   q.Node.String(),
+			ID:        q.Node.ID().String(),
+			Distances: q.Distances,
+			Found:     []string{},
+			Latency:   q.Latency,
+			Elapsed:   q.Elapsed,
+			Closest:   q.Closest,
+		}
+		for _, n := range q.Found {
+			qj.Found = append(qj.Found, n.ID().String())
+		}
+		if q.Err != nil {
+			qj.Error = q.Err.Error()
+		}
+		trace.Queries = append(trace.Queries, qj)
+		if *jsonFlag {
+			return
+		}
+
+		status := fmt.Sprintf("found=%d latency=%v", len(q.Found), q.Latency)
+		if q.Err != nil {
+			status = fmt.Sprintf("%s error=%q", status, q.Err)
+		}
+		fmt.Printf("[%8.3fs] queried id=%s addr=%v:%d logdist=%d distances=%v %s closest=%d\n",
+			q.Elapsed.Seconds(), q.Node.ID().TerminalString(), q.Node.IP(), q.Node.UDP(),
+			enode.LogDist(target, q.Node.ID()), q.Distances, status, q.Closest)
+		for _, n := range q.Found {
+			fmt.Printf("           returned id=%s logdist=%d\n", n.ID().TerminalString(), enode.LogDist(target, n.ID()))
+		}
+	})
+
+	for _, n := range result {
+		trace.Result = append(trace.Result, n.String())
+	}
+	if *jsonFlag {
+		text, err := json.MarshalIndent(trace, "", "  ")
+		if err != nil {
+			log.Fatalf("error: marshaling the trace: %v", err)
+		}
+		fmt.Println(string(text))
+		return
+	}
+	fmt.Printf("\n--- %d queries, %d closest nodes ---\n", len(trace.Queries), len(result))
+	for _, n := range result {
+		fmt.Printf("id=%s logdist=%d enr=%s\n", n.ID().TerminalString(), enode.LogDist(target, n.ID()), n)
+	}
+}
+
+// parseTarget parses the target given either as a node ID, a public key in
+// the compressed or uncompressed form, or a node URL. An empty string gives a
+// random target.
+func parseTarget(s string) (enode.ID, error) {
+	var id enode.ID
+	if s == "" {
+		crand.Read(id[:])
+		return id, nil
+	}
+	if strings.HasPrefix(s, "enr:") || strings.HasPrefix(s, "enode:") {
+		nd, err := enode.Parse(enode.ValidSchemes, s)
+		if err != nil {
+			return id, err
+		}
+		return nd.ID(), nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return id, err
+	}
+	var pub *ecdsa.PublicKey
+	switch len(b) {
+	case 32:
+		copy(id[:], b)
+		return id, nil
+	case 33:
+		pub, err = crypto.DecompressPubkey(b)
+	case 64:
+		pub, err = crypto.UnmarshalPubkey(append([]byte{0x04}, b...))
+	case 65:
+		pub, err = crypto.UnmarshalPubkey(b)
+	default:
+		return id, fmt.Errorf("unexpected length %d", len(b))
+	}
+	if err != nil {
+		return id, err
+	}
+	return enode.PubkeyToIDV4(pub), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+var (
+	outFlag = flag.String("out", "", "The file the merged results are written to (stdout if empty)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <node set file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var sets [][]snapshot.Node
+	for _, file := range flag.Args() {
+		nodes, err := snapshot.ReadFile(file)
+		if err != nil {
+			log.Fatalf("error: reading the node set %v: %v", file, err)
+		}
+		// The files written without -vantage are named after the file.
+		vantage := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		for i := range nodes {
+			if nodes[i].Vantage == "" {
+				nodes[i].Vantage = vantage
+			}
+		}
+		sets = append(sets, nodes)
+	}
+
+	merged, err := snapshot.Merge(sets...)
+	if err != nil {
+		log.Fatalf("error: merging the node sets: %v", err)
+	}
+	text, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		log.Fatalf("error: marshaling the merged results: %v", err)
+	}
+	if *outFlag == "" {
+		fmt.Println(string(text))
+	} else if err := ioutil.WriteFile(*outFlag, text, 0644); err != nil {
+		log.Fatalf("error: writing the merged results: %v", err)
+	}
+	printSummary(merged)
+}
+
+// printSummary prints to stderr how many nodes each vantage point measured
+// and is the closest to.
+func printSummary(merged []*snapshot.MergedNode) {
+	var (
+		measured = make(map[string]int)
+		closest  = make(map[string]int)
+		spreads  []time.Duration
+	)
+	for _, m := range merged {
+		for _, r := range m.Results {
+			measured[r.Vantage]++
+		}
+		if m.ClosestVantage != "" {
+			closest[m.ClosestVantage]++
+			spreads = append(spreads, m.RttSpread)
+		}
+	}
+	var vantages []string
+	for v := range measured {
+		vantages = append(vantages, v)
+	}
+	sort.Strings(vantages)
+
+	fmt.Fprintf(os.Stderr, "%d nodes from %d vantage points\n", len(merged), len(vantages))
+	for _, v := range vantages {
+		fmt.Fprintf(os.Stderr, "  %-16s measured=%d closest=%d\n", v, measured[v], closest[v])
+	}
+	if len(spreads) > 0 {
+		sort.Slice(spreads, func(i, j int) bool { return spreads[i] < spreads[j] })
+		fmt.Fprintf(os.Stderr, "median rtt spread=%v\n", spreads[len(spreads)/2])
+	}
+}
@@ -33,12 +33,16 @@ func main() {
 		BootNodes:     bootNodes,
 		Logger:        log.New(os.Stderr, "crawler: ", log.LstdFlags|log.Lmsgprefix),
 		CheckLiveness: false,
+		Dedup:         true,
 	}
 	cr := crawler.New(cfg)
-	cr.Start()
+	if err := cr.Start(); err != nil {
+		log.Fatalf("the crawler cannot be started: %v", err)
+	}
 	defer cr.Stop()
 
-	seen := make(map[string]bool)
+	// The crawler only gives the nodes which are new or have new ENRs.
+	seen := 0
 	for {
 		nd, err := cr.GetNode()
 		if err != nil {
@@ -46,13 +50,10 @@ func main() {
 		}
 		hash := sha.Sum256([]byte(nd.String()))
 		encoded := hex.EncodeToString(hash[:])
-		if _, ok := seen[nd.String()]; ok {
-			continue
-		}
-		seen[nd.String()] = true
-		log.Printf("found new ENR (hash=%v, len=%v)\n", encoded, len(seen))
+		seen++
+		log.Printf("found new ENR (hash=%v, len=%v)\n", encoded, seen)
 		if nd.IP().IsPrivate() {
-			log.Printf("found private IP in the ENR (hash=%v, len=%v)\n", encoded, len(seen))
+			log.Printf("found private IP in the ENR (hash=%v, len=%v)\n", encoded, seen)
 		}
 	}
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+// The interval between the progress reports of the batch mode.
+const progressInterval = 10 * time.Second
+
+// readNodeList reads the nodes from the file, or stdin if it's "-". The file
+// is either a node set file or a list of ENRs, one on each line. Empty lines
+// and lines starting with # are skipped. If a node is listed more than once,
+// the newest ENR is kept.
+func readNodeList(file string) ([]*enode.Node, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if file == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []snapshot.Node
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			urls = append(urls, e.NodeUrl)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		nodes []*enode.Node
+		index = make(map[enode.ID]int)
+	)
+	for _, url := range urls {
+		nd, err := enode.Parse(enode.ValidSchemes, url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %q: %v", url, err)
+		}
+		if i, ok := index[nd.ID()]; ok {
+			if nd.Seq() > nodes[i].Seq() {
+				nodes[i] = nd
+			}
+			continue
+		}
+		index[nd.ID()] = len(nodes)
+		nodes = append(nodes, nd)
+	}
+	return nodes, nil
+}
+
+// batch measures the nodes listed in the file and writes the results to the
+// node set file, or stdout if it's empty. Unlike the crawl mode, the nodes
+// which don't respond at all are also written, so that we can see which nodes
+// in the list are gone. The nodes which fail to be measured are written too,
+// with the error.
+func batch(list string, file string) {
+	nodes, err := readNodeList(list)
+	if err != nil {
+		log.Fatalf("error: reading the node list: %v", err)
+	}
+	client, err := measure.Listen(measureConfig())
+	if err != nil {
+		log.Fatalf("the measurement client cannot be created: %v", err)
+	}
+	defer client.Close()
+	manifest := newManifest(nil, client)
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		results  = make([]*snapshot.Node, len(nodes))
+		measured = 0
+		failed   = 0
+		start    = time.Now()
+	)
+	report := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		elapsed := time.Since(start)
+		var eta time.Duration
+		if measured > 0 {
+			eta = elapsed / time.Duration(measured) * time.Duration(len(nodes)-measured)
+		}
+		log.Printf("progress: measured=%d/%d failed=%d elapsed=%v eta=%v",
+			measured, len(nodes), failed, elapsed.Round(time.Second), eta.Round(time.Second))
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// This semaphore is used to limit the number of concurrent measurements.
+	semaphore := make(chan interface{}, *concurrencyFlag)
+	for i, nd := range nodes {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, nd *enode.Node) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result, err := client.Run(nd)
+			if err != nil {
+				// The node is still written, so that it isn't mistaken for
+				// a node missing from the list.
+				result = &measure.Result{LossRate: 1}
+			} else if result.LossRate < 1 {
+				// There is nothing more to measure if the node doesn't
+				// respond at all.
+				err = measureMore(client, nd, result)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			measured++
+			n := &node{nd: nd, value: *result}
+			results[i] = &snapshot.Node{
+				NodeUrl:       nd.String(),
+				Result:        *result,
+				StaleEndpoint: staleEndpoint(n),
+				Vantage:       *vantageFlag,
+				Protocol:      *protocolFlag,
+				RefreshedAt:   time.Now(),
+				UpdatedAt:     time.Now(),
+			}
+			if err != nil {
+				failed++
+				results[i].Error = err.Error()
+				log.Printf("error: id=%s %v", nd.ID().TerminalString(), err)
+			}
+		}(i, nd)
+	}
+	wg.Wait()
+	close(done)
+	report()
+
+	var out []snapshot.Node
+	for _, r := range results {
+		out = append(out, *r)
+	}
+	if file == "" {
+		text, err := json.Marshal(out)
+		if err != nil {
+			log.Fatalf("error: marshaling the results: %v", err)
+		}
+		fmt.Println(string(text))
+	} else if err := snapshot.WriteFile(file, out); err != nil {
+		log.Fatalf("error: writing the results: %v", err)
+	}
+	manifest.Counts["listed"] = int64(len(nodes))
+	manifest.Counts["measured"] = int64(measured)
+	manifest.Counts["failed"] = int64(failed)
+	manifest.Counts["nodes"] = int64(len(out))
+	manifest.EndedAt = time.Now()
+	if err := writeManifest(file, manifest); err != nil {
+		log.Fatalf("error: writing the manifest: %v", err)
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ppopth/discv5-tools/crawler"
 	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/snapshot"
+	"github.com/ppopth/discv5-tools/wire"
 )
 
 const (
@@ -26,7 +28,25 @@ var (
 	bootnodesFlag = flag.String("bootnodes", "", "Comma separated nodes used for bootstrapping")
 	crawlFlag     = flag.Bool("crawl", false, "Crawl the DHT and measure every node found")
 	enrFlag       = flag.String("enr", "", "The ENR of the node you want to measure")
+	batchFlag     = flag.String("batch", "", "Measure the nodes listed in the file (- for stdin) and exit")
 	fileFlag      = flag.String("file", "", "The file of the node set")
+	manifestFlag  = flag.String("manifest", "", "The file of the manifest of the run (default: next to the node set file or, without one, stderr)")
+	minBootFlag   = flag.Int("min-bootnodes", 1, "The minimum number of healthy boot nodes required to crawl")
+	vantageFlag   = flag.String("vantage", "", "The ID of this vantage point written with the results")
+	protocolFlag  = flag.String("protocol", measure.Discv5, "The discovery protocol used to crawl and measure, discv5 or discv4")
+	forkFlag      = flag.String("fork", "", "Only crawl the nodes with this eth2 fork digest, e.g. b5303f2a")
+	enrKeyFlag    = flag.String("enr-key", "", "Only crawl the nodes whose ENRs have this key, e.g. eth2")
+	instancesFlag = flag.Int("instances", 1, "The number of discv5 instances with node IDs spread in the keyspace used to crawl")
+	livenessFlag  = flag.Int("liveness-checks", crawler.DefaultLivenessConcurrency, "The number of nodes found by the crawler checked for liveness at the same time")
+
+	nodeIntervalFlag = flag.Duration("node-interval", measure.DefaultNodeInterval, "The minimum interval between two probes to the same node (negative means no limit)")
+	ipIntervalFlag   = flag.Duration("ip-interval", measure.DefaultIPInterval, "The minimum interval between two probes to the same IP address (negative means no limit)")
+	ppsFlag          = flag.Float64("pps", measure.DefaultPacketsPerSecond, "The maximum number of probes sent per second (negative means no limit)")
+	jitterFlag       = flag.Float64("jitter", measure.DefaultJitter, "The random fraction of the intervals added to them (negative means no jitter)")
+	sizesFlag        = flag.Bool("sizes", false, "Probe the nodes with packets of sizes up to 1280 bytes")
+	throttleFlag     = flag.Bool("throttle", false, "Probe the nodes with packet loss at increasing rates to tell throttling from loss")
+	protocolIDFlag   = flag.String("protocol-id", "discv5", "The protocol ID in the headers of the discv5 packets, for the networks derived from discv5")
+	concurrencyFlag  = flag.Int("concurrency", maxMeasurements, "The number of nodes measured at the same time in the batch mode")
 )
 
 var (
@@ -34,15 +54,36 @@ var (
 	lock    sync.Mutex
 	nodeset *nodeSet
 	timer   chan interface{}
+	// The protocol ID parsed from the option.
+	protocolID [6]byte
 )
 
 func main() {
 	flag.Parse()
 	log.Print("started discv5-tools/network-measure")
 
+	if *protocolFlag != measure.Discv5 && *protocolFlag != measure.Discv4 {
+		log.Fatalf("unknown protocol %q", *protocolFlag)
+	}
+	if *protocolFlag == measure.Discv4 && (*throttleFlag || *sizesFlag) {
+		log.Fatal("-throttle and -sizes only work with discv5")
+	}
+	var err error
+	if protocolID, err = wire.ParseProtocolID(*protocolIDFlag); err != nil {
+		log.Fatalf("invalid protocol ID: %v", err)
+	}
+	if *protocolFlag == measure.Discv4 && protocolID != wire.DefaultProtocolID() {
+		log.Fatal("-protocol-id only works with discv5")
+	}
+	if *concurrencyFlag < 1 {
+		log.Fatal("-concurrency must be at least 1")
+	}
+
 	var bootUrls []string
 	if *bootnodesFlag != "" {
 		bootUrls = strings.Split(*bootnodesFlag, ",")
+	} else if *protocolFlag == measure.Discv4 {
+		bootUrls = params.MainnetBootnodes
 	} else {
 		bootUrls = params.V5Bootnodes
 	}
@@ -53,39 +94,83 @@ func main() {
 
 	if *crawlFlag {
 		crawl(bootNodes, *fileFlag)
+	} else if *batchFlag != "" {
+		batch(*batchFlag, *fileFlag)
 	} else if *enrFlag == "" {
 		log.Fatal("please provide the ENR of the node you want to measure")
 	} else {
 		nd := enode.MustParse(*enrFlag)
-		client, err := measure.Listen()
+		client, err := measure.Listen(measureConfig())
 		if err != nil {
 			log.Fatalf("the measurement client cannot be created: %v", err)
 		}
 		result, err := client.Run(nd)
+		if err == nil {
+			err = measureMore(client, nd, result)
+		}
 		if err != nil {
 			fmt.Printf("error: %v\n", err)
 		} else {
 			fmt.Printf("result: %v\n", result)
+			if result.StaleEndpoint(nd) {
+				fmt.Printf("stale endpoint: the record says %v:%d, but the node responds from %v\n", nd.IP(), nd.UDP(), result.From())
+			}
+		}
+	}
+}
+
+// measureMore does the measurements enabled by the options in addition to
+// Run. The throttling is checked only if the node lost some packets.
+func measureMore(client *measure.Client, nd *enode.Node, result *measure.Result) error {
+	var err error
+	// The loss may be caused by the rate limiter of the node.
+	if *throttleFlag && result.LossRate > 0 {
+		if result.Throttle, err = client.MeasureThrottle(nd); err != nil {
+			return err
+		}
+	}
+	if *sizesFlag {
+		if result.Sizes, err = client.MeasureSizes(nd); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func crawl(bootNodes []*enode.Node, file string) {
 	cfg := &crawler.Config{
-		BootNodes:     bootNodes,
-		Logger:        log.New(os.Stderr, "crawler: ", log.LstdFlags|log.Lmsgprefix),
-		CheckLiveness: true,
+		BootNodes:           bootNodes,
+		Logger:              log.New(os.Stderr, "crawler: ", log.LstdFlags|log.Lmsgprefix),
+		CheckLiveness:       true,
+		LivenessConcurrency: *livenessFlag,
+		MinHealthyBootNodes: *minBootFlag,
+		Instances:           *instancesFlag,
+		SpreadKeys:          true,
+		Protocol:            *protocolFlag,
+		ProtocolID:          protocolID,
+	}
+	if *forkFlag != "" {
+		f, err := crawler.ForkDigest(*forkFlag)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		cfg.Filters = append(cfg.Filters, f)
+	}
+	if *enrKeyFlag != "" {
+		cfg.Filters = append(cfg.Filters, crawler.HasKey(*enrKeyFlag))
 	}
 	cr := crawler.New(cfg)
-	cr.Start()
+	if err := cr.Start(); err != nil {
+		log.Fatalf("the crawler cannot be started: %v", err)
+	}
 	defer cr.Stop()
 
-	client, err := measure.Listen()
+	client, err := measure.Listen(measureConfig())
 	if err != nil {
 		log.Fatalf("the measurement client cannot be created: %v", err)
 	}
 
-	nodeset = newNodeset(log.New(os.Stderr, "nodeset: ", log.LstdFlags|log.Lmsgprefix))
+	nodeset = newNodeset(log.New(os.Stderr, "nodeset: ", log.LstdFlags|log.Lmsgprefix), *vantageFlag, *protocolFlag)
 	// Run a routine to check the nodes in the nodeset regularly if they are
 	// still alive.
 	timer = make(chan interface{})
@@ -110,8 +195,20 @@ func crawl(bootNodes []*enode.Node, file string) {
 				timer <- struct{}{}
 			}
 		}
+	}
+	m := newManifest(bootNodes, client)
+	m.Config["check-liveness"] = cfg.CheckLiveness
+	if file != "" {
 		// Run a routine to autosave the nodeset to the file.
-		go autosave(file)
+		go autosave(file, m, cr, client)
+	} else if *manifestFlag != "" {
+		go autosaveManifest(m, cr, client)
+	} else {
+		// The manifest goes to stderr only once, so that it doesn't flood
+		// the logs.
+		lock.Lock()
+		writeCrawlManifest("", m, cr, client)
+		lock.Unlock()
 	}
 
 	// This semaphore is used to limit the number of concurrent measurements.
@@ -143,6 +240,9 @@ func crawl(bootNodes []*enode.Node, file string) {
 			if result.LossRate == 1 {
 				return
 			}
+			if err := measureMore(client, nd, result); err != nil {
+				log.Printf("error: %v\n", err)
+			}
 			lock.Lock()
 			defer lock.Unlock()
 			emptied := nodeset.len() == 0
@@ -170,14 +270,20 @@ func gc(client *measure.Client) {
 				semaphore <- struct{}{}
 				defer wg.Done()
 				defer func() { <-semaphore }()
-				success := false
+				var (
+					resp *measure.Whoareyou
+					pong *measure.Pong
+					err  error
+				)
 				for i := 0; i < 5; i++ {
-					_, _, err := client.Send(n.nd)
-					if err != nil {
-						continue
+					if *protocolFlag == measure.Discv4 {
+						pong, _, err = client.Ping(n.nd)
+					} else {
+						resp, _, err = client.Probe(n.nd)
+					}
+					if err == nil {
+						break
 					}
-					success = true
-					break
 				}
 				lock.Lock()
 				defer lock.Unlock()
@@ -187,8 +293,8 @@ func gc(client *measure.Client) {
 					return
 				}
 
-				if success {
-					nodeset.refresh(n.nd.ID())
+				if err == nil {
+					nodeset.refresh(n.nd.ID(), resp, pong)
 				} else {
 					nodeset.remove(n.nd.ID())
 				}
@@ -210,10 +316,11 @@ func gc(client *measure.Client) {
 	}
 }
 
-func autosave(file string) {
+func autosave(file string, m *snapshot.Manifest, cr *crawler.Crawler, client *measure.Client) {
 	c := time.Tick(1 * time.Minute)
 	for range c {
 		lock.Lock()
+		writeCrawlManifest(file, m, cr, client)
 		f, err := os.Create(file)
 		if err != nil {
 			log.Fatalf("error: creating a file: %v", file)
@@ -234,3 +341,14 @@ func autosave(file string) {
 		f.Close()
 	}
 }
+
+func measureConfig() *measure.Config {
+	return &measure.Config{
+		NodeInterval:     *nodeIntervalFlag,
+		IPInterval:       *ipIntervalFlag,
+		PacketsPerSecond: *ppsFlag,
+		Jitter:           *jitterFlag,
+		Protocol:         *protocolFlag,
+		ProtocolID:       protocolID,
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/crawler"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+// newManifest creates the manifest of this run with all the options.
+func newManifest(bootNodes []*enode.Node, client *measure.Client) *snapshot.Manifest {
+	m := snapshot.NewManifest("network-measure")
+	for _, nd := range bootNodes {
+		m.BootNodes = append(m.BootNodes, nd.String())
+	}
+	m.LocalIDs = []string{client.Self().ID().String()}
+	m.Vantage = *vantageFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		m.Config[f.Name] = f.Value.String()
+	})
+	m.Config["attempts"] = measure.NumAttempts
+	m.Config["timeout"] = measure.Timeout.String()
+	return m
+}
+
+// writeCrawlManifest updates the manifest with the state of the crawl and
+// writes it next to the node set file. It must be called with the lock held.
+func writeCrawlManifest(file string, m *snapshot.Manifest, cr *crawler.Crawler, client *measure.Client) {
+	// The IDs of the crawler come first, so that the first one is the
+	// reference of coverage.
+	m.LocalIDs = nil
+	for _, id := range cr.IDs() {
+		m.LocalIDs = append(m.LocalIDs, id.String())
+	}
+	m.LocalIDs = append(m.LocalIDs, client.Self().ID().String())
+	stats := cr.Stats()
+	m.Counts["found"] = stats.Found
+	m.Counts["filtered"] = stats.Filtered
+	m.Counts["alive"] = stats.Alive
+	m.Counts["dead"] = stats.Dead
+	m.Counts["nodes"] = int64(nodeset.len())
+	m.EndedAt = time.Now()
+	if err := writeManifest(file, m); err != nil {
+		log.Printf("error: writing the manifest: %v", err)
+	}
+}
+
+// autosaveManifest writes the manifest of a crawl without the node set file
+// every minute.
+func autosaveManifest(m *snapshot.Manifest, cr *crawler.Crawler, client *measure.Client) {
+	for range time.Tick(1 * time.Minute) {
+		lock.Lock()
+		writeCrawlManifest("", m, cr, client)
+		lock.Unlock()
+	}
+}
+
+// writeManifest writes the manifest to the file in the -manifest option or,
+// if it's not given, next to the node set file. If there is no node set file
+// either, the manifest is written to stderr.
+func writeManifest(file string, m *snapshot.Manifest) error {
+	if *manifestFlag == "" && file != "" {
+		return snapshot.WriteManifest(file, m)
+	}
+	text, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *manifestFlag != "" {
+		return ioutil.WriteFile(*manifestFlag, text, 0644)
+	}
+	_, err = fmt.Fprintf(os.Stderr, "manifest: %s\n", text)
+	return err
+}
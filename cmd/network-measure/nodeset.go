@@ -9,6 +9,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/snapshot"
 )
 
 const (
@@ -28,13 +29,18 @@ type nodeSet struct {
 	l   *clist.List
 	ht  map[enode.ID]*clist.Element
 	log *log.Logger
+	// The vantage ID and the protocol written with the nodes.
+	vantage  string
+	protocol string
 }
 
-func newNodeset(logger *log.Logger) *nodeSet {
+func newNodeset(logger *log.Logger, vantage, protocol string) *nodeSet {
 	return &nodeSet{
-		l:   clist.New(),
-		ht:  make(map[enode.ID]*clist.Element),
-		log: logger,
+		l:        clist.New(),
+		ht:       make(map[enode.ID]*clist.Element),
+		log:      logger,
+		vantage:  vantage,
+		protocol: protocol,
 	}
 }
 
@@ -56,16 +62,39 @@ func (s *nodeSet) remove(id enode.ID) {
 	}
 }
 
-func (s *nodeSet) refresh(id enode.ID) {
+// refresh marks the node as alive. resp is the WHOAREYOU or PONG response,
+// depending on the protocol, which proves that.
+func (s *nodeSet) refresh(id enode.ID, resp *measure.Whoareyou, pong *measure.Pong) {
 	e := s.ht[id]
 	if e != nil {
+		n := e.Value.(*node)
 		s.l.MoveToFront(e)
-		e.Value.(*node).expiry = time.Now().Add(timeout)
-		e.Value.(*node).refreshedAt = time.Now()
+		n.expiry = time.Now().Add(timeout)
+		n.refreshedAt = time.Now()
+		n.value.Whoareyou = resp
+		n.value.Pong = pong
 		s.log.Printf("refreshed id=%s nodeset={%v}", id.TerminalString(), s)
+		s.checkEndpoint(n)
 	}
 }
 
+// checkEndpoint logs a stale endpoint finding if the node responds from an
+// address other than the one in its record.
+func (s *nodeSet) checkEndpoint(n *node) {
+	if addr := staleEndpoint(n); addr != "" {
+		s.log.Printf("stale endpoint id=%s enr=%v:%d from=%s", n.nd.ID().TerminalString(), n.nd.IP(), n.nd.UDP(), addr)
+	}
+}
+
+// staleEndpoint returns the address which the node responds from if it's not
+// the endpoint in the record. Otherwise, it returns the empty string.
+func staleEndpoint(n *node) string {
+	if !n.value.StaleEndpoint(n.nd) {
+		return ""
+	}
+	return n.value.From().String()
+}
+
 func (s *nodeSet) String() string {
 	return fmt.Sprintf("len=%v", s.len())
 }
@@ -95,6 +124,7 @@ func (s *nodeSet) add(n *enode.Node, res measure.Result) {
 		el := s.l.PushFront(&node{n, res, time.Now().Add(timeout), time.Now(), time.Now()})
 		s.ht[n.ID()] = el
 		s.log.Printf("added id=%s result=%v nodeset={%v}", n.ID().TerminalString(), res, s)
+		s.checkEndpoint(el.Value.(*node))
 		return
 	}
 	if n.Seq() > e.Value.(*node).nd.Seq() {
@@ -102,28 +132,29 @@ func (s *nodeSet) add(n *enode.Node, res measure.Result) {
 		e.Value = &node{n, res, time.Now().Add(timeout), time.Now(), time.Now()}
 		s.l.MoveToFront(e)
 		s.log.Printf("updated id=%s result=%v nodeset={%v}", n.ID().TerminalString(), res, s)
+		s.checkEndpoint(e.Value.(*node))
 	}
 }
 
-type nodeJson struct {
-	NodeUrl string
-	Result  measure.Result
-
-	RefreshedAt time.Time
-	UpdatedAt   time.Time
-}
-
 func (s *nodeSet) MarshalJSON() ([]byte, error) {
-	nodes := []nodeJson{}
+	nodes := []snapshot.Node{}
 	for e := s.l.Front(); e != nil; e = e.Next() {
 		node := e.Value.(*node)
-		nodes = append(nodes, nodeJson{node.nd.String(), node.value, node.refreshedAt, node.updatedAt})
+		nodes = append(nodes, snapshot.Node{
+			NodeUrl:       node.nd.String(),
+			Result:        node.value,
+			StaleEndpoint: staleEndpoint(node),
+			Vantage:       s.vantage,
+			Protocol:      s.protocol,
+			RefreshedAt:   node.refreshedAt,
+			UpdatedAt:     node.updatedAt,
+		})
 	}
 	return json.Marshal(nodes)
 }
 
 func (s *nodeSet) UnmarshalJSON(b []byte) error {
-	var nodes []nodeJson
+	var nodes []snapshot.Node
 	err := json.Unmarshal(b, &nodes)
 	if err != nil {
 		return err
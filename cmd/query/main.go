@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ppopth/discv5-tools/query"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+var (
+	whereFlag  = flag.String("where", "", "The filter of the nodes, e.g. \"fork=b5303f2a && loss<0.05\"")
+	sortFlag   = flag.String("sort", "", "The field to sort the nodes by, prefixed with - for the descending order")
+	limitFlag  = flag.Int("limit", 0, "The maximum number of nodes printed (0 means no limit)")
+	formatFlag = flag.String("format", "json", "The output format: json, csv, enr or bootnodes")
+	fieldsFlag = flag.String("fields", "id,ip,udp,fork,client,rtt,loss,updated", "Comma separated fields printed in the csv format")
+	asnFlag    = flag.String("asn-db", "", "The file mapping the IP ranges to the AS numbers, used by the asn field")
+)
+
+// validField reports whether the field can be printed in the csv format.
+func validField(name string) bool {
+	for _, f := range query.Fields {
+		if f == name && f != "key" {
+			return true
+		}
+	}
+	return false
+}
+
+// readNodes reads the node set from the file, or from the URL if it starts
+// with http:// or https://.
+func readNodes(src string) ([]snapshot.Node, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return snapshot.ReadFile(src)
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []snapshot.Node
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <node set file or URL>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "fields: %s\n", strings.Join(query.Fields, " "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	filter, err := query.Parse(*whereFlag)
+	if err != nil {
+		log.Fatalf("error: invalid filter: %v", err)
+	}
+	fields := strings.Split(*fieldsFlag, ",")
+	for _, f := range fields {
+		if !validField(f) {
+			log.Fatalf("error: unknown field %q in -fields", f)
+		}
+	}
+	// Without the table, the AS numbers are all 0.
+	usesASN := filter.Uses("asn") || strings.TrimPrefix(*sortFlag, "-") == "asn"
+	if *formatFlag == "csv" {
+		for _, f := range fields {
+			usesASN = usesASN || f == "asn"
+		}
+	}
+	if usesASN && *asnFlag == "" {
+		log.Fatal("error: the asn field needs the -asn-db option")
+	}
+	var asns *query.ASNTable
+	if *asnFlag != "" {
+		if asns, err = query.ReadASNFile(*asnFlag); err != nil {
+			log.Fatalf("error: reading the AS numbers: %v", err)
+		}
+	}
+	var entries []*query.Entry
+	for _, file := range flag.Args() {
+		nodes, err := readNodes(file)
+		if err != nil {
+			log.Fatalf("error: reading the node set %v: %v", file, err)
+		}
+		es, err := query.Entries(nodes)
+		if err != nil {
+			log.Fatalf("error: reading the node set %v: %v", file, err)
+		}
+		for _, e := range es {
+			if asns != nil {
+				e.ASN = asns.Lookup(e.Record.IP())
+			}
+			if filter.Match(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	if *sortFlag != "" {
+		if err := query.Sort(entries, *sortFlag); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+	if *limitFlag > 0 && len(entries) > *limitFlag {
+		entries = entries[:*limitFlag]
+	}
+
+	switch *formatFlag {
+	case "json":
+		nodes := make([]snapshot.Node, 0, len(entries))
+		for _, e := range entries {
+			nodes = append(nodes, *e.Node)
+		}
+		text, err := json.Marshal(nodes)
+		if err != nil {
+			log.Fatalf("error: marshaling the nodes: %v", err)
+		}
+		fmt.Println(string(text))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(fields)
+		for _, e := range entries {
+			row := make([]string, len(fields))
+			for i, f := range fields {
+				row[i] = e.Format(f)
+			}
+			w.Write(row)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatalf("error: writing the csv: %v", err)
+		}
+	case "enr":
+		for _, e := range entries {
+			fmt.Println(e.NodeUrl)
+		}
+	case "bootnodes":
+		urls := make([]string, 0, len(entries))
+		for _, e := range entries {
+			urls = append(urls, e.NodeUrl)
+		}
+		fmt.Println(strings.Join(urls, ","))
+	default:
+		log.Fatalf("error: unknown format %q", *formatFlag)
+	}
+}
@@ -0,0 +1,279 @@
+package conformance
+
+import (
+	"crypto/ecdsa"
+	crand "crypto/rand"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+// Expectation is how a conforming implementation should respond.
+type Expectation int
+
+const (
+	// Any response is fine. It's used for the cases where the spec leaves it
+	// to the implementation.
+	ExpectAny Expectation = iota
+	ExpectWhoareyou
+	ExpectSilence
+	// The node accepts the handshake and answers the message in it.
+	ExpectMessage
+)
+
+func (e Expectation) String() string {
+	switch e {
+	case ExpectWhoareyou:
+		return "whoareyou"
+	case ExpectSilence:
+		return "silence"
+	case ExpectMessage:
+		return "message"
+	default:
+		return "any"
+	}
+}
+
+// An undefined value of the packet header flag.
+const invalidFlag = 7
+
+// local is the identity used to craft the packets.
+type local struct {
+	key *ecdsa.PrivateKey
+	nd  *enode.Node
+}
+
+// Case is a crafted test case sent to the target.
+type Case struct {
+	Name   string
+	Expect Expectation
+	// If it's true, the target is asked for a WHOAREYOU challenge first and
+	// the challenge is given to craft.
+	NeedsChallenge bool
+	craft          func(l *local, nd *enode.Node, challenge *v5wire.Header) ([][]byte, error)
+}
+
+// Cases is the catalogue of the test cases.
+var Cases = []Case{
+	{
+		Name:   "valid-random-packet",
+		Expect: ExpectWhoareyou,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, nil, nil)
+		},
+	},
+	{
+		Name:   "truncated-static-header",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, nil, func(b []byte) []byte { return b[:30] })
+		},
+	},
+	{
+		Name:   "truncated-auth-data",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			// The masking IV and the static header are 39 bytes and the auth
+			// data is 32 bytes.
+			return randomPacket(l, nd, nil, func(b []byte) []byte { return b[:39+16] })
+		},
+	},
+	{
+		Name:   "empty-message",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, nil, func(b []byte) []byte { return b[:39+32] })
+		},
+	},
+	{
+		Name:   "oversized-auth-size",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) { head.AuthSize = 0xffff }, nil)
+		},
+	},
+	{
+		Name:   "zero-auth-size",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) {
+				head.AuthSize = 0
+				head.AuthData = nil
+			}, nil)
+		},
+	},
+	{
+		Name:   "bad-protocol-id",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) {
+				copy(head.ProtocolID[:], "discv4")
+			}, nil)
+		},
+	},
+	{
+		Name:   "version-below-minimum",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) { head.Version = 0 }, nil)
+		},
+	},
+	{
+		Name:   "future-version",
+		Expect: ExpectAny,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) { head.Version = 2 }, nil)
+		},
+	},
+	{
+		Name:   "invalid-flag",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, func(head *v5wire.Header) { head.Flag = invalidFlag }, nil)
+		},
+	},
+	{
+		Name:   "unsolicited-whoareyou",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			challenge, err := fakeChallenge()
+			if err != nil {
+				return nil, err
+			}
+			packet, err := wire.EncodeRawPacket(nd.ID(), *challenge, nil)
+			return [][]byte{packet}, err
+		},
+	},
+	{
+		Name:   "oversized-packet",
+		Expect: ExpectAny,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			return randomPacket(l, nd, nil, func(b []byte) []byte {
+				return append(b, make([]byte, 1500-len(b))...)
+			})
+		},
+	},
+	{
+		Name:   "replayed-nonce",
+		Expect: ExpectWhoareyou,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			packets, err := randomPacket(l, nd, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return [][]byte{packets[0], packets[0]}, nil
+		},
+	},
+	{
+		Name:           "valid-handshake",
+		Expect:         ExpectMessage,
+		NeedsChallenge: true,
+		craft: func(l *local, nd *enode.Node, challenge *v5wire.Header) ([][]byte, error) {
+			return handshakePacket(l, nd, challenge, nil)
+		},
+	},
+	{
+		Name:           "handshake-bad-signature",
+		Expect:         ExpectSilence,
+		NeedsChallenge: true,
+		craft: func(l *local, nd *enode.Node, challenge *v5wire.Header) ([][]byte, error) {
+			return handshakePacket(l, nd, challenge, func(head *v5wire.Header) {
+				// The signature comes right after the fixed-size part.
+				head.AuthData[34] ^= 0xff
+			})
+		},
+	},
+	{
+		Name:           "handshake-bad-pubkey-size",
+		Expect:         ExpectSilence,
+		NeedsChallenge: true,
+		craft: func(l *local, nd *enode.Node, challenge *v5wire.Header) ([][]byte, error) {
+			return handshakePacket(l, nd, challenge, func(head *v5wire.Header) {
+				head.AuthData[33] = 0xff
+			})
+		},
+	},
+	{
+		Name:           "handshake-garbage-record",
+		Expect:         ExpectSilence,
+		NeedsChallenge: true,
+		craft: func(l *local, nd *enode.Node, challenge *v5wire.Header) ([][]byte, error) {
+			return handshakePacket(l, nd, challenge, func(head *v5wire.Header) {
+				garbage := make([]byte, 40)
+				crand.Read(garbage)
+				head.AuthData = append(head.AuthData, garbage...)
+				head.AuthSize = uint16(len(head.AuthData))
+			})
+		},
+	},
+	{
+		Name:   "handshake-without-challenge",
+		Expect: ExpectSilence,
+		craft: func(l *local, nd *enode.Node, _ *v5wire.Header) ([][]byte, error) {
+			challenge, err := fakeChallenge()
+			if err != nil {
+				return nil, err
+			}
+			return handshakePacket(l, nd, challenge, nil)
+		},
+	},
+}
+
+// CaseByName returns the case with the given name.
+func CaseByName(name string) (Case, bool) {
+	for _, c := range Cases {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Case{}, false
+}
+
+// randomPacket crafts a random packet like the ones used in the measurement.
+// The header and the encoded packet can be modified with the given functions.
+func randomPacket(l *local, nd *enode.Node, modifyHeader func(*v5wire.Header), modifyPacket func([]byte) []byte) ([][]byte, error) {
+	head, msgData, err := wire.GenRandomPacket(l.nd.ID(), nd.ID())
+	if err != nil {
+		return nil, err
+	}
+	if modifyHeader != nil {
+		modifyHeader(&head)
+	}
+	packet, err := wire.EncodeRawPacket(nd.ID(), head, msgData)
+	if err != nil {
+		return nil, err
+	}
+	if modifyPacket != nil {
+		packet = modifyPacket(packet)
+	}
+	return [][]byte{packet}, nil
+}
+
+// handshakePacket crafts a handshake packet answering the challenge with a
+// PING message. The header can be modified with the given function.
+func handshakePacket(l *local, nd *enode.Node, challenge *v5wire.Header, modifyHeader func(*v5wire.Header)) ([][]byte, error) {
+	ping := &v5wire.Ping{ReqID: []byte{1}, ENRSeq: l.nd.Seq()}
+	head, msgData, _, err := wire.GenHandshakePacket(l.key, l.nd, nd, challenge, ping)
+	if err != nil {
+		return nil, err
+	}
+	if modifyHeader != nil {
+		modifyHeader(&head)
+	}
+	packet, err := wire.EncodeRawPacket(nd.ID(), head, msgData)
+	return [][]byte{packet}, err
+}
+
+// fakeChallenge crafts a WHOAREYOU packet which the target never sent.
+func fakeChallenge() (*v5wire.Header, error) {
+	var nonce v5wire.Nonce
+	if _, err := crand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	head, err := wire.GenWhoareyouPacket(nonce, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
@@ -0,0 +1,250 @@
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+const (
+	maxPacketSize = 1280
+	// The number of random packets sent to check if the target is still alive
+	// after a case.
+	livenessAttempts = 3
+)
+
+var errNoChallenge = errors.New("the target didn't send a WHOAREYOU challenge")
+
+// Response kinds.
+const (
+	RespWhoareyou = "whoareyou"
+	RespMessage   = "message"
+	RespHandshake = "handshake"
+	RespInvalid   = "invalid"
+)
+
+// Result is the result of running a case against the target.
+type Result struct {
+	Case string
+	// The kinds of the packets received from the target after sending the
+	// crafted packets.
+	Responses []string
+	// If the target still answers random packets after the case. If it
+	// doesn't, it may have crashed.
+	Alive bool
+	// If the responses match what the case expects.
+	Conforming bool
+	Err        error
+}
+
+func (r *Result) String() string {
+	verdict := "ok"
+	switch {
+	case r.Err != nil:
+		verdict = fmt.Sprintf("error(%v)", r.Err)
+	case !r.Alive:
+		verdict = "dead"
+	case !r.Conforming:
+		verdict = "unexpected"
+	}
+	return fmt.Sprintf("%-28s responses=%v alive=%v %s", r.Case, r.Responses, r.Alive, verdict)
+}
+
+// Tester sends the crafted packets to a target.
+type Tester struct {
+	l       *local
+	usocket *net.UDPConn
+	nd      *enode.Node
+	addr    *net.UDPAddr
+	timeout time.Duration
+}
+
+// NewTester creates a tester of the target node. The timeout is how long we
+// wait for responses after sending the packets.
+func NewTester(nd *enode.Node, timeout time.Duration) (*Tester, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	db, err := enode.OpenDB("")
+	if err != nil {
+		return nil, err
+	}
+	ln := enode.NewLocalNode(db, key)
+	socket, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return nil, err
+	}
+	usocket := socket.(*net.UDPConn)
+	uaddr := usocket.LocalAddr().(*net.UDPAddr)
+	ln.SetFallbackIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(uaddr.Port)
+
+	return &Tester{
+		l:       &local{key: key, nd: ln.Node()},
+		usocket: usocket,
+		nd:      nd,
+		addr:    &net.UDPAddr{IP: nd.IP(), Port: nd.UDP()},
+		timeout: timeout,
+	}, nil
+}
+
+func (t *Tester) Close() {
+	t.usocket.Close()
+}
+
+// Run runs the case against the target with a new tester. Running every case
+// with a new identity is safer than sharing a tester, because after a
+// handshake the target may send its own requests to our identity, which would
+// be taken as the responses of the later cases.
+func Run(nd *enode.Node, c Case, timeout time.Duration) (*Result, error) {
+	t, err := NewTester(nd, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.Run(c), nil
+}
+
+// Run runs the case against the target.
+func (t *Tester) Run(c Case) *Result {
+	r := &Result{Case: c.Name, Responses: []string{}}
+	var challenge *v5wire.Header
+	if c.NeedsChallenge {
+		challenge, r.Err = t.Challenge()
+		if r.Err != nil {
+			r.Alive = t.alive()
+			return r
+		}
+	}
+
+	packets, err := c.craft(t.l, t.nd, challenge)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	for _, packet := range packets {
+		if _, err := t.usocket.WriteToUDP(packet, t.addr); err != nil {
+			r.Err = err
+			return r
+		}
+	}
+	for _, head := range t.receive(t.timeout) {
+		r.Responses = append(r.Responses, kind(head))
+	}
+
+	r.Alive = t.alive()
+	r.Conforming = conforming(c.Expect, r.Responses)
+	return r
+}
+
+// conforming reports whether the responses match the expectation.
+func conforming(e Expectation, responses []string) bool {
+	switch e {
+	case ExpectSilence:
+		return len(responses) == 0
+	case ExpectWhoareyou, ExpectMessage:
+		want := RespWhoareyou
+		if e == ExpectMessage {
+			want = RespMessage
+		}
+		if len(responses) == 0 {
+			return false
+		}
+		for _, resp := range responses {
+			if resp != want {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+func kind(head *v5wire.Header) string {
+	if head == nil {
+		return RespInvalid
+	}
+	if _, err := wire.DecodeWhoareyouAuthData(head); err == nil {
+		return RespWhoareyou
+	}
+	if _, err := wire.DecodeMessageAuthData(head); err == nil {
+		return RespMessage
+	}
+	if _, err := wire.DecodeHandshakeAuthData(head); err == nil {
+		return RespHandshake
+	}
+	return RespInvalid
+}
+
+// receive reads the packets from the target until the timeout. The packets
+// which can't be decoded are returned as nil.
+func (t *Tester) receive(timeout time.Duration) []*v5wire.Header {
+	var heads []*v5wire.Header
+	deadline := time.Now().Add(timeout)
+	for {
+		head, err := t.read(deadline)
+		if err != nil {
+			return heads
+		}
+		heads = append(heads, head)
+	}
+}
+
+// read reads the next packet from the target before the deadline.
+func (t *Tester) read(deadline time.Time) (*v5wire.Header, error) {
+	buf := make([]byte, maxPacketSize)
+	t.usocket.SetReadDeadline(deadline)
+	for {
+		n, addr, err := t.usocket.ReadFromUDP(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !addr.IP.Equal(t.addr.IP) || addr.Port != t.addr.Port {
+			continue
+		}
+		head, _, err := wire.DecodeRawPacket(buf[:n], t.l.nd.ID())
+		if err != nil {
+			return nil, nil
+		}
+		return head, nil
+	}
+}
+
+// Challenge sends a random packet and waits for the WHOAREYOU challenge.
+func (t *Tester) Challenge() (*v5wire.Header, error) {
+	packets, err := randomPacket(t.l, t.nd, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.usocket.WriteToUDP(packets[0], t.addr); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(t.timeout)
+	for {
+		head, err := t.read(deadline)
+		if err != nil {
+			return nil, errNoChallenge
+		}
+		if kind(head) == RespWhoareyou {
+			return head, nil
+		}
+	}
+}
+
+// alive checks if the target still answers random packets.
+func (t *Tester) alive() bool {
+	for i := 0; i < livenessAttempts; i++ {
+		if _, err := t.Challenge(); err == nil {
+			return true
+		}
+	}
+	return false
+}
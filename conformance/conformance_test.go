@@ -0,0 +1,24 @@
+package conformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppopth/discv5-tools/internal/testnode"
+)
+
+// TestGethConforms runs every case against go-ethereum, which is the
+// reference implementation here.
+func TestGethConforms(t *testing.T) {
+	disc := testnode.StartV5(t, nil)
+
+	for _, c := range Cases {
+		r, err := Run(disc.Self(), c, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Err != nil || !r.Alive || !r.Conforming {
+			t.Errorf("unexpected result: %v", r)
+		}
+	}
+}
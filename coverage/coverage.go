@@ -0,0 +1,160 @@
+// Package coverage analyzes how evenly the node IDs cover the keyspace.
+package coverage
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// MaxBits is the maximum number of prefix bits used to bin the node IDs.
+const MaxBits = 16
+
+// The minimum expected count of a bin in the chi-square test. The bins with
+// fewer expected nodes are pooled together.
+const minExpected = 5
+
+// Bin is a region of the keyspace.
+type Bin struct {
+	// The prefix of the node IDs or the log distance to the reference ID. For
+	// the pooled log distance bins, it's the highest distance in the pool and
+	// Low is the lowest one.
+	Value int
+	Low   int
+
+	Observed int
+	Expected float64
+	// The standardized residual, (Observed-Expected)/sqrt(Expected).
+	Residual float64
+}
+
+// Label returns the name of the bin.
+func (b *Bin) Label(bits int) string {
+	if bits > 0 {
+		return fmt.Sprintf("%0*b", bits, b.Value)
+	}
+	if b.Low != b.Value {
+		return fmt.Sprintf("%d-%d", b.Low, b.Value)
+	}
+	return fmt.Sprint(b.Value)
+}
+
+// Analysis is the comparison of the node IDs with the uniform distribution.
+type Analysis struct {
+	Bins []Bin
+	// The chi-square statistic, the degrees of freedom and the p-value.
+	ChiSquare float64
+	DF        int
+	P         float64
+}
+
+// Over returns the bins with more nodes than expected, whose residuals are
+// at least the threshold.
+func (a *Analysis) Over(threshold float64) []Bin {
+	var bins []Bin
+	for _, b := range a.Bins {
+		if b.Residual >= threshold {
+			bins = append(bins, b)
+		}
+	}
+	return bins
+}
+
+// Under returns the bins with fewer nodes than expected, whose residuals are
+// at most minus the threshold.
+func (a *Analysis) Under(threshold float64) []Bin {
+	var bins []Bin
+	for _, b := range a.Bins {
+		if b.Residual <= -threshold {
+			bins = append(bins, b)
+		}
+	}
+	return bins
+}
+
+// ByPrefix bins the node IDs by their first bits and compares the counts with
+// the uniform distribution.
+func ByPrefix(ids []enode.ID, bits int) (*Analysis, error) {
+	if bits < 1 || bits > MaxBits {
+		return nil, fmt.Errorf("the number of bits must be between 1 and %d", MaxBits)
+	}
+	bins := make([]Bin, 1<<bits)
+	expected := float64(len(ids)) / float64(len(bins))
+	for i := range bins {
+		bins[i] = Bin{Value: i, Low: i, Expected: expected}
+	}
+	for _, id := range ids {
+		bins[prefix(id, bits)].Observed++
+	}
+	return analyze(bins), nil
+}
+
+// prefix returns the first bits of the ID.
+func prefix(id enode.ID, bits int) int {
+	v := int(id[0])<<16 | int(id[1])<<8 | int(id[2])
+	return v >> (24 - bits)
+}
+
+// ByLogDistance bins the node IDs by their log distances to the reference ID
+// and compares the counts with the uniform distribution, where half of the
+// nodes are expected at the distance 256, a quarter at 255 and so on. The
+// bins at low distances, which are expected to be nearly empty, are pooled so
+// that each bin is expected to have at least a few nodes.
+func ByLogDistance(ids []enode.ID, ref enode.ID) *Analysis {
+	var counts [257]int
+	for _, id := range ids {
+		counts[enode.LogDist(id, ref)]++
+	}
+	n := float64(len(ids))
+
+	var bins []Bin
+	// Pool the bins from the highest distance down and put everything left
+	// in the last bin.
+	cur := Bin{Value: 256}
+	for d := 256; d >= 0; d-- {
+		cur.Low = d
+		cur.Observed += counts[d]
+		cur.Expected += n * distanceProb(d)
+		if cur.Expected >= minExpected && d > 0 {
+			bins = append(bins, cur)
+			cur = Bin{Value: d - 1}
+		}
+	}
+	if len(bins) > 0 && cur.Expected < minExpected {
+		last := &bins[len(bins)-1]
+		last.Low = cur.Low
+		last.Observed += cur.Observed
+		last.Expected += cur.Expected
+	} else {
+		bins = append(bins, cur)
+	}
+	return analyze(bins)
+}
+
+// distanceProb is the probability that a random ID is at the log distance.
+func distanceProb(d int) float64 {
+	if d == 0 {
+		return math.Ldexp(1, -256)
+	}
+	return math.Ldexp(1, d-257)
+}
+
+func analyze(bins []Bin) *Analysis {
+	a := &Analysis{Bins: bins}
+	for i := range bins {
+		b := &bins[i]
+		if b.Expected > 0 {
+			diff := float64(b.Observed) - b.Expected
+			b.Residual = diff / math.Sqrt(b.Expected)
+			a.ChiSquare += diff * diff / b.Expected
+		}
+	}
+	a.DF = len(bins) - 1
+	if a.DF > 0 {
+		a.P = chiSquareSurvival(a.ChiSquare, a.DF)
+	} else {
+		a.P = 1
+	}
+	return a
+}
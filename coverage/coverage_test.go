@@ -0,0 +1,108 @@
+package coverage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func TestChiSquareSurvival(t *testing.T) {
+	// The critical values at the significance level of 0.05.
+	tests := []struct {
+		x  float64
+		df int
+	}{
+		{3.841, 1},
+		{18.307, 10},
+		{124.342, 100},
+		{293.248, 255},
+	}
+	for _, test := range tests {
+		if p := chiSquareSurvival(test.x, test.df); math.Abs(p-0.05) > 0.001 {
+			t.Errorf("df=%d x=%v: got p=%v, want 0.05", test.df, test.x, p)
+		}
+	}
+}
+
+func randomIDs(t *testing.T, n int) []enode.ID {
+	ids := make([]enode.ID, n)
+	for i := range ids {
+		if _, err := rand.Read(ids[i][:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+func TestByPrefix(t *testing.T) {
+	ids := randomIDs(t, 4000)
+	a, err := ByPrefix(ids, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Bins) != 16 || a.DF != 15 || a.Bins[0].Expected != 250 {
+		t.Fatalf("wrong bins: %d bins, df=%d", len(a.Bins), a.DF)
+	}
+	// It fails with the probability of about 1e-6.
+	if a.P < 1e-6 {
+		t.Errorf("random IDs aren't uniform: chi-square=%v p=%v", a.ChiSquare, a.P)
+	}
+
+	// Put every ID in the prefix 0101.
+	for i := range ids {
+		ids[i][0] = 0x50 | ids[i][0]&0x0f
+	}
+	if a, _ = ByPrefix(ids, 4); a.P > 1e-6 {
+		t.Errorf("skewed IDs are uniform: p=%v", a.P)
+	}
+	over := a.Over(3)
+	if len(over) != 1 || over[0].Label(4) != "0101" {
+		t.Errorf("wrong over-populated bins: %+v", over)
+	}
+	if under := a.Under(3); len(under) != 15 {
+		t.Errorf("got %d under-populated bins, want 15", len(under))
+	}
+
+	if _, err := ByPrefix(ids, MaxBits+1); err == nil {
+		t.Error("no error for too many bits")
+	}
+}
+
+func TestByLogDistance(t *testing.T) {
+	ids := randomIDs(t, 4000)
+	a := ByLogDistance(ids, enode.ID{})
+	total := 0
+	for _, b := range a.Bins {
+		total += b.Observed
+		if b.Expected < minExpected {
+			t.Errorf("the bin %s has %v expected nodes", b.Label(0), b.Expected)
+		}
+	}
+	if total != len(ids) {
+		t.Errorf("got %d nodes in the bins, want %d", total, len(ids))
+	}
+	if a.Bins[0].Value != 256 || a.Bins[len(a.Bins)-1].Low != 0 {
+		t.Errorf("the bins don't cover all the distances")
+	}
+	if a.P < 1e-6 {
+		t.Errorf("random IDs aren't uniform: chi-square=%v p=%v", a.ChiSquare, a.P)
+	}
+}
+
+func TestWriteHeatmap(t *testing.T) {
+	a, err := ByPrefix(randomIDs(t, 100), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteHeatmap(&buf, a, 3, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<rect"); n != 8 {
+		t.Errorf("got %d cells, want 8", n)
+	}
+}
@@ -0,0 +1,46 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// The size of a cell of the heatmap in pixels.
+const cellSize = 24
+
+// WriteHeatmap renders the prefix bins as an SVG heatmap. The bins are laid
+// out row by row in the order of the prefixes. The bins with as many nodes as
+// expected are white, the over-populated ones are red and the
+// under-populated ones are blue, saturated at the residual of the threshold.
+func WriteHeatmap(w io.Writer, a *Analysis, bits int, threshold float64) error {
+	cols := 1 << ((bits + 1) / 2)
+	rows := (len(a.Bins) + cols - 1) / cols
+	width, height := cols*cellSize, rows*cellSize
+
+	if _, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		width, height, width, height); err != nil {
+		return err
+	}
+	for i, b := range a.Bins {
+		x, y := (i%cols)*cellSize, (i/cols)*cellSize
+		_, err := fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#ccc\">"+
+			"<title>%s: %d nodes, %.1f expected, residual %.2f</title></rect>\n",
+			x, y, cellSize, cellSize, color(b.Residual, threshold), b.Label(bits), b.Observed, b.Expected, b.Residual)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// color maps the residual to a color from blue through white to red.
+func color(residual, threshold float64) string {
+	t := math.Max(-1, math.Min(1, residual/threshold))
+	fade := int(255 * (1 - math.Abs(t)))
+	if t > 0 {
+		return fmt.Sprintf("#ff%02x%02x", fade, fade)
+	}
+	return fmt.Sprintf("#%02x%02xff", fade, fade)
+}
@@ -3,22 +3,33 @@ package crawler
 import (
 	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/health"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/session"
+	"github.com/ppopth/discv5-tools/wire"
 )
 
 var (
 	errCrawlerRunning = errors.New("crawler already running")
 	errCrawlerStopped = errors.New("crawler stopped")
+	errBootNodes      = errors.New("too few healthy boot nodes")
 )
 
-// A shadow interface of discover.UDPv5, so we can do dependency injection
-// with a fake one.
+// DefaultLivenessConcurrency is the default number of liveness checks done at
+// the same time.
+const DefaultLivenessConcurrency = 16
+
+// A shadow interface of discover.UDPv5 and discover.UDPv4, so we can do
+// dependency injection with a fake one.
 type discv5 interface {
 	RandomNodes() enode.Iterator
 	RequestENR(*enode.Node) (*enode.Node, error)
@@ -34,15 +45,64 @@ type Config struct {
 	// If it's true, it will check the liveness of the node before outputing
 	// the node.
 	CheckLiveness bool
+	// The number of liveness checks done at the same time. If it's zero,
+	// the default value is used.
+	LivenessConcurrency int
+	// If it's true, a node is sent out only if its ID is new or its ENR seq
+	// is higher than the one seen before. At most DedupSize node IDs are
+	// remembered and, if it's zero, DefaultDedupSize is used.
+	Dedup     bool
+	DedupSize int
+	// If it's true, the nodes seen before are also sent out with the kind
+	// NodeReseen. It's only used with Dedup.
+	ReportReseen bool
+	// The node is sent out only if it passes all the filters. The filters are
+	// applied before the liveness check, so the nodes filtered out aren't
+	// contacted.
+	Filters []Filter
+	// If it's positive, the boot nodes are checked when the crawler starts.
+	// Only the healthy ones are used and the crawler fails to start if there
+	// are fewer of them than this number.
+	MinHealthyBootNodes int
+	// The number of discv5 instances run with distinct keys. They share the
+	// liveness checks, the deduplication and the subscriptions. If it's zero,
+	// one instance is run.
+	Instances int
+	// If it's true, the keys of the instances are chosen so that their node
+	// IDs are evenly spread in the keyspace.
+	SpreadKeys bool
+	// The discovery protocol, measure.Discv5 or measure.Discv4. If it's
+	// empty, discv5 is used.
+	Protocol string
+	// The protocol ID in the headers of the discv5 packets. If it's zero,
+	// wire.DefaultProtocolID is used. discover.UDPv5 only speaks the default
+	// one, so the instances with another protocol ID do the lookups with
+	// session.Client instead.
+	ProtocolID [6]byte
+}
+
+// Stats is the counters of the crawler.
+type Stats struct {
+	// The number of nodes found by the iterator.
+	Found int64
+	// The number of nodes rejected by the filters.
+	Filtered int64
+	// The number of liveness checks which are running.
+	InFlight int64
+	// The number of nodes which pass and fail the liveness checks.
+	Alive int64
+	Dead  int64
 }
 
 // Crawler is a container for states of a cralwer node.
 type Crawler struct {
+	// The counters are accessed atomically, so they are put first to be
+	// 64-bit aligned.
+	stats Stats
+
 	config *Config
-	// The interface used to communicate with the ethereum DHT.
-	disc discv5
-	// The private key used to run the ethereum node.
-	privateKey *ecdsa.PrivateKey
+	// The discv5 instances used to communicate with the ethereum DHT.
+	instances []*instance
 	// The log used inside the crawler.
 	log *log.Logger
 
@@ -50,64 +110,197 @@ type Crawler struct {
 	lock sync.Mutex
 	// Used to wait for the goroutines to finish.
 	loopWG sync.WaitGroup
+	// Used to wait for the iterators of the instances to finish.
+	runWG sync.WaitGroup
 	// Used to send a signal when the crawler stops.
 	quit chan struct{}
 	// Used to indicate if the crawling is running.
 	running bool
-	// Used to send a new node out when the user wants it.
-	ndCh chan *enode.Node
+	// Used to indicate if Start is checking the boot nodes.
+	starting bool
+	// The subscriptions which the events are sent to.
+	subs []*Subscription
+	// Closed when there is the first subscription.
+	subscribed chan struct{}
+	// The subscription used by GetNode.
+	nodeSub *Subscription
+	// The node IDs seen before, if the deduplication is enabled.
+	seen *seenCache
 }
 
 // New creates a new crawler.
 func New(config *Config) *Crawler {
-	// If no private key is provided, generate a new key.
-	// We can ignore an error over here, because it's just a key generation
-	// and there will be no error.
-	privateKey, _ := crypto.GenerateKey()
-
 	if config.Logger == nil {
 		config.Logger = log.Default()
 	}
+	n := config.Instances
+	if n <= 0 {
+		n = 1
+	}
+	var keys []*ecdsa.PrivateKey
+	if config.SpreadKeys {
+		keys = spreadKeys(n)
+	} else {
+		keys = randomKeys(n)
+	}
 
-	return &Crawler{
-		config:     config,
-		privateKey: privateKey,
-		log:        config.Logger,
+	c := &Crawler{
+		config: config,
+		log:    config.Logger,
+	}
+	for i, key := range keys {
+		c.instances = append(c.instances, &instance{index: i, privateKey: key})
 	}
+	return c
 }
 
+// GetNode waits for the next node found. It's a shorthand of a subscription
+// of the node events with PolicyBlock, which is created on the first call.
 func (c *Crawler) GetNode() (*enode.Node, error) {
+	ev, err := c.GetNodeEvent()
+	if err != nil {
+		return nil, err
+	}
+	return ev.Node, nil
+}
+
+// GetNodeEvent is like GetNode, but also tells whether the node is new,
+// updated or re-seen if the deduplication is enabled.
+func (c *Crawler) GetNodeEvent() (*NodeEvent, error) {
 	c.lock.Lock()
 	if !c.running {
+		c.lock.Unlock()
 		return nil, errCrawlerStopped
 	}
+	if c.nodeSub == nil {
+		c.nodeSub = c.subscribe(&SubscribeOptions{
+			Policy: PolicyBlock,
+			Types:  []EventType{EventNodeFound, EventENRUpdated},
+		})
+	}
+	sub := c.nodeSub
 	c.lock.Unlock()
 
-	select {
-	case nd := <-c.ndCh:
-		return nd, nil
-	case <-c.quit:
+	ev, ok := <-sub.Events()
+	if !ok {
 		return nil, errCrawlerStopped
 	}
+	return &NodeEvent{Node: ev.Node, Kind: ev.Kind}, nil
 }
 
 func (c *Crawler) Start() error {
+	if p := c.config.Protocol; p != "" && p != measure.Discv5 && p != measure.Discv4 {
+		return fmt.Errorf("unknown protocol %q", p)
+	}
+	if c.config.Protocol == measure.Discv4 && c.customProtocolID() {
+		return fmt.Errorf("the protocol ID only applies to discv5")
+	}
+	// Don't spend a health check of the boot nodes if the crawler can't be
+	// started anyway.
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	if c.running {
+	if c.running || c.starting {
+		c.lock.Unlock()
 		return errCrawlerRunning
 	}
+	c.starting = true
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.starting = false
+		c.lock.Unlock()
+	}()
+
+	bootNodes := c.config.BootNodes
+	// The health check of the boot nodes only speaks discv5.
+	if c.config.MinHealthyBootNodes > 0 && c.config.Protocol == measure.Discv4 {
+		c.log.Printf("skipped the health check of the boot nodes with discv4")
+	} else if c.config.MinHealthyBootNodes > 0 {
+		var err error
+		if bootNodes, err = c.checkBootNodes(); err != nil {
+			return err
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, inst := range c.instances {
+		if err := c.setupDiscovery(inst, bootNodes); err != nil {
+			for _, started := range c.instances[:i] {
+				started.disc.Close()
+			}
+			return err
+		}
+	}
+	c.startLoop()
+	return nil
+}
+
+// startLoop starts crawling with the discv5 instances. It must be called with
+// the lock held.
+func (c *Crawler) startLoop() {
 	c.running = true
 	c.quit = make(chan struct{})
-	c.ndCh = make(chan *enode.Node)
+	c.subscribed = make(chan struct{})
+	// The node IDs seen are kept when the crawler is restarted.
+	if c.config.Dedup && c.seen == nil {
+		size := c.config.DedupSize
+		if size <= 0 {
+			size = DefaultDedupSize
+		}
+		c.seen = newSeenCache(size)
+	}
 
-	if err := c.setupDiscovery(); err != nil {
-		return err
+	// The liveness checks are done by a pool of workers, so that a dead node
+	// doesn't block the discovery of the other nodes until the request times
+	// out. The alive nodes are sent out in the order that the checks finish.
+	var checkCh chan check
+	if c.config.CheckLiveness {
+		concurrency := c.config.LivenessConcurrency
+		if concurrency <= 0 {
+			concurrency = DefaultLivenessConcurrency
+		}
+		checkCh = make(chan check)
+		for i := 0; i < concurrency; i++ {
+			c.loopWG.Add(1)
+			go c.checkLoop(checkCh)
+		}
 	}
 
-	c.loopWG.Add(1)
-	go c.run()
-	return nil
+	for _, inst := range c.instances {
+		c.loopWG.Add(1)
+		c.runWG.Add(1)
+		go c.run(inst, checkCh)
+	}
+	if checkCh != nil {
+		// Stop the workers when all the iterators are done.
+		c.loopWG.Add(1)
+		go func() {
+			defer c.loopWG.Done()
+			c.runWG.Wait()
+			close(checkCh)
+		}()
+	}
+}
+
+// Stats returns the current counters of all the instances.
+func (c *Crawler) Stats() Stats {
+	return c.stats.load()
+}
+
+func (s *Stats) load() Stats {
+	return Stats{
+		Found:    atomic.LoadInt64(&s.Found),
+		Filtered: atomic.LoadInt64(&s.Filtered),
+		InFlight: atomic.LoadInt64(&s.InFlight),
+		Alive:    atomic.LoadInt64(&s.Alive),
+		Dead:     atomic.LoadInt64(&s.Dead),
+	}
+}
+
+// count adds the delta to the counter of both the crawler and the instance.
+func (c *Crawler) count(inst *instance, counter func(s *Stats) *int64, delta int64) {
+	atomic.AddInt64(counter(&c.stats), delta)
+	atomic.AddInt64(counter(&inst.stats), delta)
 }
 
 func (c *Crawler) Stop() {
@@ -119,41 +312,152 @@ func (c *Crawler) Stop() {
 	c.running = false
 	// Send a signal to the running routines that it is stopping.
 	close(c.quit)
-	c.disc.Close()
+	for _, inst := range c.instances {
+		inst.disc.Close()
+	}
 	c.lock.Unlock()
 	c.loopWG.Wait()
+
+	// Unsubscribe removes the subscription from c.subs, so iterate a copy.
+	c.lock.Lock()
+	subs := append([]*Subscription(nil), c.subs...)
+	c.nodeSub = nil
+	c.lock.Unlock()
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
 }
 
-func (c *Crawler) run() {
-	iter := c.disc.RandomNodes()
-	defer iter.Close()
+// check is a node to be checked by the instance which found it.
+type check struct {
+	inst *instance
+	n    *enode.Node
+}
+
+func (c *Crawler) run(inst *instance, checkCh chan<- check) {
 	defer c.loopWG.Done()
+	defer c.runWG.Done()
+	iter := inst.disc.RandomNodes()
+	defer iter.Close()
+
 	for iter.Next() {
 		n := iter.Node()
+		c.count(inst, func(s *Stats) *int64 { return &s.Found }, 1)
+		if !c.accept(n) {
+			c.count(inst, func(s *Stats) *int64 { return &s.Filtered }, 1)
+			continue
+		}
 		if c.config.CheckLiveness {
-			// We have to directly request the ENR from the node to make sure that
-			// the node is alive.
-			nn, err := c.disc.RequestENR(n)
-			if err != nil {
-				// If it's not alive, log and skip to the next node.
-				c.log.Printf("found unalive node (id=%s)", n.ID().TerminalString())
-				continue
+			select {
+			case checkCh <- check{inst, n}:
+			case <-c.quit:
+				return
 			}
-			// Save the alive node to check for the duplication later.
-			c.log.Printf("found alive node (id=%s)", nn.ID().TerminalString())
-			c.ndCh <- nn
 		} else {
 			c.log.Printf("found a node (id=%s)", n.ID().TerminalString())
-			c.ndCh <- n
+			if !c.send(inst, n) {
+				return
+			}
 		}
 	}
 }
 
-// Run all the necessary steps to produce `c.disc`.
-func (c *Crawler) setupDiscovery() error {
+// checkLoop checks the liveness of the nodes from the channel until it's
+// closed.
+func (c *Crawler) checkLoop(checkCh <-chan check) {
+	defer c.loopWG.Done()
+	for ch := range checkCh {
+		inst, n := ch.inst, ch.n
+		c.count(inst, func(s *Stats) *int64 { return &s.InFlight }, 1)
+		// We have to directly request the ENR from the node to make sure that
+		// the node is alive.
+		nn, err := inst.disc.RequestENR(n)
+		c.count(inst, func(s *Stats) *int64 { return &s.InFlight }, -1)
+		if err != nil {
+			// If it's not alive, log and skip to the next node.
+			c.count(inst, func(s *Stats) *int64 { return &s.Dead }, 1)
+			c.log.Printf("found unalive node (id=%s)", n.ID().TerminalString())
+			ev := &Event{Type: EventLivenessFailed, Time: time.Now(), Instance: inst.index, Node: n, Err: err}
+			if !c.publish(ev) {
+				return
+			}
+			continue
+		}
+		c.count(inst, func(s *Stats) *int64 { return &s.Alive }, 1)
+		c.log.Printf("found alive node (id=%s)", nn.ID().TerminalString())
+		if !c.send(inst, nn) {
+			return
+		}
+	}
+}
+
+// send sends the node out unless it's a duplicate. It returns false if the
+// crawler is stopped.
+func (c *Crawler) send(inst *instance, n *enode.Node) bool {
+	ev := &Event{Type: EventNodeFound, Time: time.Now(), Instance: inst.index, Node: n, Kind: NodeFound}
+	if c.seen != nil {
+		ev.Kind = c.seen.see(n)
+		if ev.Kind == NodeReseen && !c.config.ReportReseen {
+			return true
+		}
+		if ev.Kind == NodeUpdated {
+			ev.Type = EventENRUpdated
+		}
+	}
+	return c.publish(ev)
+}
+
+// Check the boot nodes and return the healthy ones.
+func (c *Crawler) checkBootNodes() ([]*enode.Node, error) {
+	statuses, err := health.CheckAllProtocol(c.config.BootNodes, c.protocolID())
+	if err != nil {
+		return nil, err
+	}
+	var healthy []*enode.Node
+	for _, s := range statuses {
+		if s.Healthy() {
+			c.log.Printf("found healthy boot node (%v)", s)
+			healthy = append(healthy, s.Node)
+		} else {
+			c.log.Printf("found unhealthy boot node (%v)", s)
+		}
+	}
+	if len(healthy) < c.config.MinHealthyBootNodes {
+		return nil, fmt.Errorf("%w: %d of %d are healthy", errBootNodes, len(healthy), len(statuses))
+	}
+	return healthy, nil
+}
+
+// protocolID returns the protocol ID of the discv5 packets.
+func (c *Crawler) protocolID() [6]byte {
+	if c.config.ProtocolID == ([6]byte{}) {
+		return wire.DefaultProtocolID()
+	}
+	return c.config.ProtocolID
+}
+
+// customProtocolID reports whether the protocol ID isn't the default one.
+func (c *Crawler) customProtocolID() bool {
+	return c.protocolID() != wire.DefaultProtocolID()
+}
+
+// Run all the necessary steps to produce `inst.disc`.
+func (c *Crawler) setupDiscovery(inst *instance, bootNodes []*enode.Node) error {
+	if c.customProtocolID() {
+		client, err := session.Listen(&session.Config{
+			PrivateKey: inst.privateKey,
+			ProtocolID: c.config.ProtocolID,
+		})
+		if err != nil {
+			return err
+		}
+		inst.disc = newSessionDisc(client, bootNodes)
+		return nil
+	}
+
 	cfg := discover.Config{
-		PrivateKey: c.privateKey,
-		Bootnodes:  c.config.BootNodes,
+		PrivateKey: inst.privateKey,
+		Bootnodes:  bootNodes,
 	}
 	// By putting the empty string, it will create a memory database instead
 	// of a persistent database.
@@ -182,9 +486,13 @@ func (c *Crawler) setupDiscovery() error {
 	}
 	ln.SetFallbackUDP(uaddr.Port)
 
-	// ListenV5 listens on the given connection. It creates many goroutines to
-	// handle events and incoming packets.
-	c.disc, err = discover.ListenV5(usocket, ln, cfg)
+	// ListenV5 and ListenV4 listen on the given connection. They create many
+	// goroutines to handle events and incoming packets.
+	if c.config.Protocol == measure.Discv4 {
+		inst.disc, err = discover.ListenV4(usocket, ln, cfg)
+	} else {
+		inst.disc, err = discover.ListenV5(usocket, ln, cfg)
+	}
 	if err != nil {
 		return err
 	}
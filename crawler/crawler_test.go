@@ -1,7 +1,9 @@
 package crawler
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
@@ -41,3 +43,109 @@ func TestNew(t *testing.T) {
 		t.Error("New doesn't reference the config")
 	}
 }
+
+func TestStartWithUnhealthyBootNodes(t *testing.T) {
+	// Nobody listens on this port, so the boot node can't be healthy.
+	bootNode := enode.MustParse(nodeInfos[5].url)
+	bootNode = enode.NewV4(bootNode.Pubkey(), []byte{127, 0, 0, 1}, 0, 1)
+	c := New(&Config{
+		BootNodes:           []*enode.Node{bootNode},
+		MinHealthyBootNodes: 1,
+	})
+	err := c.Start()
+	if !errors.Is(err, errBootNodes) {
+		t.Fatalf("Start returns %v, want %v", err, errBootNodes)
+	}
+	if c.running {
+		t.Error("the crawler is running after failing to start")
+	}
+}
+
+func TestStartRunning(t *testing.T) {
+	// The boot node isn't healthy, so Start fails with errBootNodes if it
+	// checks the boot nodes before seeing the crawler running.
+	bootNode := enode.MustParse(nodeInfos[5].url)
+	bootNode = enode.NewV4(bootNode.Pubkey(), []byte{127, 0, 0, 1}, 0, 1)
+	c := startFake(&Config{
+		BootNodes:           []*enode.Node{bootNode},
+		MinHealthyBootNodes: 1,
+	}, &fakeDisc{})
+	defer c.Stop()
+
+	start := time.Now()
+	if err := c.Start(); err != errCrawlerRunning {
+		t.Fatalf("Start returns %v, want %v", err, errCrawlerRunning)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Start takes %v to fail", elapsed)
+	}
+}
+
+// fakeDisc is a fake discv5 whose RandomNodes returns a fixed list of nodes.
+// RequestENR of a dead node blocks until release is closed and fails.
+type fakeDisc struct {
+	nodes   []*enode.Node
+	dead    map[enode.ID]bool
+	release chan struct{}
+}
+
+func (d *fakeDisc) RandomNodes() enode.Iterator {
+	return enode.IterNodes(d.nodes)
+}
+
+func (d *fakeDisc) RequestENR(n *enode.Node) (*enode.Node, error) {
+	if d.dead[n.ID()] {
+		<-d.release
+		return nil, errors.New("timeout")
+	}
+	return n, nil
+}
+
+func (d *fakeDisc) Close() {}
+
+// startFake starts the crawler with an instance for each fake discv5.
+func startFake(config *Config, discs ...*fakeDisc) *Crawler {
+	config.Instances = len(discs)
+	c := New(config)
+	c.lock.Lock()
+	for i, disc := range discs {
+		c.instances[i].disc = disc
+	}
+	c.startLoop()
+	c.lock.Unlock()
+	return c
+}
+
+func TestParallelLiveness(t *testing.T) {
+	disc := &fakeDisc{dead: make(map[enode.ID]bool), release: make(chan struct{})}
+	// The dead nodes come first, so that they would block the alive ones if
+	// the checks were done one by one.
+	for i, info := range nodeInfos[:4] {
+		n := enode.MustParse(info.url)
+		if i < 2 {
+			disc.dead[n.ID()] = true
+		}
+		disc.nodes = append(disc.nodes, n)
+	}
+	c := startFake(&Config{CheckLiveness: true, LivenessConcurrency: 3}, disc)
+	defer c.Stop()
+
+	for i := 0; i < 2; i++ {
+		nd, err := c.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if disc.dead[nd.ID()] {
+			t.Fatalf("got the dead node %s", nd.ID().TerminalString())
+		}
+	}
+	// The workers of the dead nodes may not have counted themselves yet.
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().InFlight != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := c.Stats(); s.Found != 4 || s.Alive != 2 || s.InFlight != 2 {
+		t.Errorf("wrong stats while the dead nodes are checked: %+v", s)
+	}
+	close(disc.release)
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// DefaultDedupSize is the default number of node IDs remembered by the
+// deduplication.
+const DefaultDedupSize = 100000
+
+// NodeKind tells how a node found by the crawler relates to the nodes found
+// before.
+type NodeKind int
+
+const (
+	// The deduplication is disabled, so we don't know.
+	NodeFound NodeKind = iota
+	// The node ID hasn't been seen.
+	NodeNew
+	// The node has a higher ENR seq than the one seen before.
+	NodeUpdated
+	// The node has been seen with the same or a higher ENR seq.
+	NodeReseen
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeNew:
+		return "new"
+	case NodeUpdated:
+		return "updated"
+	case NodeReseen:
+		return "re-seen"
+	default:
+		return "found"
+	}
+}
+
+// NodeEvent is a node found by the crawler.
+type NodeEvent struct {
+	Node *enode.Node
+	Kind NodeKind
+}
+
+// seenCache remembers the highest ENR seq of the recently seen node IDs. When
+// it's full, the least recently seen ID is forgotten, so a node seen again
+// after that is new again.
+type seenCache struct {
+	lock  sync.Mutex
+	size  int
+	ll    *list.List
+	items map[enode.ID]*list.Element
+}
+
+type seenEntry struct {
+	id  enode.ID
+	seq uint64
+}
+
+func newSeenCache(size int) *seenCache {
+	return &seenCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[enode.ID]*list.Element),
+	}
+}
+
+// see records the node and tells whether it's new, updated or re-seen.
+func (s *seenCache) see(n *enode.Node) NodeKind {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, ok := s.items[n.ID()]; ok {
+		s.ll.MoveToFront(el)
+		e := el.Value.(*seenEntry)
+		if n.Seq() > e.seq {
+			e.seq = n.Seq()
+			return NodeUpdated
+		}
+		return NodeReseen
+	}
+	s.items[n.ID()] = s.ll.PushFront(&seenEntry{id: n.ID(), seq: n.Seq()})
+	if s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*seenEntry).id)
+	}
+	return NodeNew
+}
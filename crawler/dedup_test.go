@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func TestSeenCache(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSeq := func(seq uint64) *enode.Node {
+		var r enr.Record
+		r.SetSeq(seq)
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+		nd, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	other := enode.MustParse(nodeInfos[1].url)
+	another := enode.MustParse(nodeInfos[2].url)
+
+	s := newSeenCache(2)
+	steps := []struct {
+		node *enode.Node
+		want NodeKind
+	}{
+		{withSeq(2), NodeNew},
+		{withSeq(2), NodeReseen},
+		{withSeq(1), NodeReseen},
+		{withSeq(3), NodeUpdated},
+		{other, NodeNew},
+		// The first node is the least recently seen one, so it's forgotten.
+		{another, NodeNew},
+		{other, NodeReseen},
+		{withSeq(3), NodeNew},
+	}
+	for i, step := range steps {
+		if got := s.see(step.node); got != step.want {
+			t.Errorf("step %d: got %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	disc := &fakeDisc{}
+	// The first and the fifth nodes are the same.
+	for _, info := range nodeInfos[:5] {
+		disc.nodes = append(disc.nodes, enode.MustParse(info.url))
+	}
+	c := startFake(&Config{Dedup: true, ReportReseen: true}, disc)
+	defer c.Stop()
+
+	for i := range disc.nodes {
+		ev, err := c.GetNodeEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := NodeNew
+		if i == 4 {
+			want = NodeReseen
+		}
+		if ev.Kind != want {
+			t.Errorf("node %d is %v, want %v", i, ev.Kind, want)
+		}
+	}
+}
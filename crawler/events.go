@@ -0,0 +1,254 @@
+package crawler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// DefaultBufferSize is the default number of events buffered for a
+// subscription.
+const DefaultBufferSize = 256
+
+// EventType is the type of the crawl events.
+type EventType int
+
+const (
+	// A node is found. Event.Kind tells if it's new, if the deduplication is
+	// enabled.
+	EventNodeFound EventType = iota
+	// A node seen before is found with a higher ENR seq. It's only sent if
+	// the deduplication is enabled.
+	EventENRUpdated
+	// A node fails the liveness check. Event.Err is the error of the check.
+	EventLivenessFailed
+	// The periodic counters of the crawler in Event.Stats.
+	EventStats
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNodeFound:
+		return "node-found"
+	case EventENRUpdated:
+		return "enr-updated"
+	case EventLivenessFailed:
+		return "liveness-failed"
+	case EventStats:
+		return "stats"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a crawl event.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// The index of the instance which found the node or zero.
+	Instance int
+	// The node of the node events.
+	Node *enode.Node
+	Kind NodeKind
+	// The error of EventLivenessFailed.
+	Err error
+	// The counters of EventStats.
+	Stats Stats
+}
+
+// Policy tells what to do when the buffer of a subscription is full.
+type Policy int
+
+const (
+	// Wait until the subscriber takes an event. It slows down the crawler, so
+	// no event is lost.
+	PolicyBlock Policy = iota
+	// Drop the oldest event in the buffer to make room for the new one.
+	PolicyDropOldest
+	// Drop the new event.
+	PolicyDropNewest
+)
+
+// SubscribeOptions is the options of a subscription.
+type SubscribeOptions struct {
+	// The number of events buffered. If it's zero, DefaultBufferSize is used.
+	BufferSize int
+	Policy     Policy
+	// The types of the events sent. If it's empty, all the types are sent.
+	Types []EventType
+	// If it's positive, EventStats is sent at this interval.
+	StatsInterval time.Duration
+}
+
+// Subscription is a stream of crawl events.
+type Subscription struct {
+	// Accessed atomically, so it's put first to be 64-bit aligned.
+	dropped int64
+
+	c      *Crawler
+	policy Policy
+	types  map[EventType]bool
+	ch     chan *Event
+	// Closed when the subscription is closed. The senders hold the read lock
+	// while sending, so ch is only closed after they're gone.
+	done      chan struct{}
+	closeOnce sync.Once
+	lock      sync.RWMutex
+	closed    bool
+}
+
+// Events returns the channel of the events. It's closed when the subscription
+// is closed or the crawler stops.
+func (s *Subscription) Events() <-chan *Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Unsubscribe closes the subscription.
+func (s *Subscription) Unsubscribe() {
+	s.closeOnce.Do(func() {
+		s.c.lock.Lock()
+		for i, sub := range s.c.subs {
+			if sub == s {
+				s.c.subs = append(s.c.subs[:i], s.c.subs[i+1:]...)
+				break
+			}
+		}
+		s.c.lock.Unlock()
+
+		close(s.done)
+		s.lock.Lock()
+		s.closed = true
+		close(s.ch)
+		s.lock.Unlock()
+	})
+}
+
+func (s *Subscription) wants(t EventType) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// deliver sends the event according to the policy. It returns false if the
+// crawler stops while it's blocked.
+func (s *Subscription) deliver(ev *Event, quit <-chan struct{}) bool {
+	if !s.wants(ev.Type) {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return true
+	}
+	switch s.policy {
+	case PolicyDropNewest:
+		select {
+		case s.ch <- ev:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case s.ch <- ev:
+				return true
+			default:
+			}
+			select {
+			case <-s.ch:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		case <-quit:
+			return false
+		}
+	}
+	return true
+}
+
+// Subscribe starts a stream of crawl events. The crawler doesn't send out any
+// node until there is the first subscription, so the nodes found before aren't
+// lost. The subscriptions are closed when the crawler stops.
+func (c *Crawler) Subscribe(opts *SubscribeOptions) (*Subscription, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.running {
+		return nil, errCrawlerStopped
+	}
+	return c.subscribe(opts), nil
+}
+
+// subscribe is Subscribe which must be called with the lock held.
+func (c *Crawler) subscribe(opts *SubscribeOptions) *Subscription {
+	size := opts.BufferSize
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	s := &Subscription{
+		c:      c,
+		policy: opts.Policy,
+		types:  make(map[EventType]bool),
+		ch:     make(chan *Event, size),
+		done:   make(chan struct{}),
+	}
+	for _, t := range opts.Types {
+		s.types[t] = true
+	}
+	c.subs = append(c.subs, s)
+	select {
+	case <-c.subscribed:
+	default:
+		close(c.subscribed)
+	}
+	if opts.StatsInterval > 0 {
+		go c.statsLoop(s, opts.StatsInterval, c.quit)
+	}
+	return s
+}
+
+func (c *Crawler) statsLoop(s *Subscription, interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ev := &Event{Type: EventStats, Time: time.Now(), Stats: c.Stats()}
+			if !s.deliver(ev, quit) {
+				return
+			}
+		case <-s.done:
+			return
+		case <-quit:
+			return
+		}
+	}
+}
+
+// publish sends the event to all the subscriptions. It waits for the first
+// subscription and returns false if the crawler stops.
+func (c *Crawler) publish(ev *Event) bool {
+	select {
+	case <-c.subscribed:
+	case <-c.quit:
+		return false
+	}
+	c.lock.Lock()
+	subs := append([]*Subscription(nil), c.subs...)
+	c.lock.Unlock()
+	for _, s := range subs {
+		if !s.deliver(ev, c.quit) {
+			return false
+		}
+	}
+	return true
+}
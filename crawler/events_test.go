@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func waitDropped(t *testing.T, sub *Subscription, n int64) {
+	deadline := time.Now().Add(time.Second)
+	for sub.Dropped() != n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d := sub.Dropped(); d != n {
+		t.Fatalf("got %d dropped events, want %d", d, n)
+	}
+}
+
+func TestSubscribePolicies(t *testing.T) {
+	disc := &fakeDisc{}
+	for _, info := range nodeInfos[:4] {
+		disc.nodes = append(disc.nodes, enode.MustParse(info.url))
+	}
+	tests := []struct {
+		policy Policy
+		want   []*enode.Node
+	}{
+		{PolicyDropNewest, disc.nodes[:2]},
+		{PolicyDropOldest, disc.nodes[2:]},
+	}
+	for _, test := range tests {
+		c := startFake(&Config{}, disc)
+		sub, err := c.Subscribe(&SubscribeOptions{BufferSize: 2, Policy: test.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitDropped(t, sub, 2)
+		for _, want := range test.want {
+			ev := <-sub.Events()
+			if ev.Type != EventNodeFound || ev.Node.ID() != want.ID() {
+				t.Errorf("policy %d: got %v %s, want %s", test.policy, ev.Type,
+					ev.Node.ID().TerminalString(), want.ID().TerminalString())
+			}
+		}
+		c.Stop()
+		if _, ok := <-sub.Events(); ok {
+			t.Errorf("policy %d: the events aren't closed after the crawler stops", test.policy)
+		}
+	}
+}
+
+func TestSubscribeLivenessFailed(t *testing.T) {
+	disc := &fakeDisc{dead: make(map[enode.ID]bool), release: make(chan struct{})}
+	close(disc.release)
+	for i, info := range nodeInfos[:3] {
+		n := enode.MustParse(info.url)
+		disc.dead[n.ID()] = i == 1
+		disc.nodes = append(disc.nodes, n)
+	}
+	c := startFake(&Config{CheckLiveness: true}, disc)
+	defer c.Stop()
+	sub, err := c.Subscribe(&SubscribeOptions{Types: []EventType{EventLivenessFailed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := <-sub.Events()
+	if ev.Type != EventLivenessFailed || ev.Node.ID() != disc.nodes[1].ID() || ev.Err == nil {
+		t.Errorf("wrong event: %+v", ev)
+	}
+	sub.Unsubscribe()
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("the events aren't closed after unsubscribing")
+	}
+}
+
+func TestGetNodeStopped(t *testing.T) {
+	c := New(&Config{})
+	if _, err := c.GetNode(); err != errCrawlerStopped {
+		t.Fatalf("GetNode returns %v, want %v", err, errCrawlerStopped)
+	}
+	// GetNode used to return with the lock held, so this would block.
+	if _, err := c.Subscribe(&SubscribeOptions{}); err != errCrawlerStopped {
+		t.Fatalf("Subscribe returns %v, want %v", err, errCrawlerStopped)
+	}
+}
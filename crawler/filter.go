@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/record"
+)
+
+// Filter tells whether the crawler should send out the node.
+type Filter func(n *enode.Node) bool
+
+// HasKey accepts the nodes whose records have the entry.
+func HasKey(key string) Filter {
+	return func(n *enode.Node) bool {
+		return record.HasKey(n.Record(), key)
+	}
+}
+
+// ForkDigest accepts the nodes whose "eth2" entries have the fork digest,
+// given in hex with or without 0x.
+func ForkDigest(digest string) (Filter, error) {
+	digest = strings.ToLower(strings.TrimPrefix(digest, "0x"))
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != 4 {
+		return nil, fmt.Errorf("invalid fork digest %q", digest)
+	}
+	return func(n *enode.Node) bool {
+		return record.ForkDigest(n.Record()) == digest
+	}, nil
+}
+
+// IPRange accepts the nodes whose IP addresses are in the CIDR range.
+func IPRange(cidr string) (Filter, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return func(n *enode.Node) bool {
+		ip := n.IP()
+		return ip != nil && ipnet.Contains(ip)
+	}, nil
+}
+
+// IDPrefix accepts the nodes whose IDs start with the prefix in hex.
+func IDPrefix(prefix string) (Filter, error) {
+	prefix = strings.ToLower(prefix)
+	for _, ch := range prefix {
+		if !strings.ContainsRune("0123456789abcdef", ch) {
+			return nil, fmt.Errorf("invalid node ID prefix %q", prefix)
+		}
+	}
+	return func(n *enode.Node) bool {
+		return strings.HasPrefix(n.ID().String(), prefix)
+	}, nil
+}
+
+// accept tells whether the node passes all the filters.
+func (c *Crawler) accept(n *enode.Node) bool {
+	for _, f := range c.config.Filters {
+		if !f(n) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func TestFilters(t *testing.T) {
+	// The fork digests are afcaaba0, b5303f2a and none. The IP addresses are
+	// 3.19.194.157, 54.178.44.198 and 3.26.30.32.
+	nodes := []*enode.Node{
+		enode.MustParse(nodeInfos[0].url),
+		enode.MustParse(nodeInfos[1].url),
+		enode.MustParse(nodeInfos[5].url),
+	}
+	must := func(f Filter, err error) Filter {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []bool
+	}{
+		{"key", HasKey("attnets"), []bool{false, true, false}},
+		{"fork", must(ForkDigest("0xB5303F2A")), []bool{false, true, false}},
+		{"ip", must(IPRange("3.0.0.0/8")), []bool{true, false, true}},
+		{"id", must(IDPrefix("F9")), []bool{true, false, false}},
+	}
+	for _, test := range tests {
+		for i, n := range nodes {
+			if got := test.filter(n); got != test.want[i] {
+				t.Errorf("%s: node %d got %v, want %v", test.name, i, got, test.want[i])
+			}
+		}
+	}
+
+	if _, err := ForkDigest("b5303f"); err == nil {
+		t.Error("no error for a short fork digest")
+	}
+	if _, err := IDPrefix("xyz"); err == nil {
+		t.Error("no error for an invalid prefix")
+	}
+}
+
+func TestFilterBeforeLiveness(t *testing.T) {
+	// The nodes filtered out are dead, so the crawler would send liveness
+	// failed events if it checked them. The node passing the filter comes
+	// last, so the others are done when it's sent out.
+	disc := &fakeDisc{dead: make(map[enode.ID]bool), release: make(chan struct{})}
+	close(disc.release)
+	for _, i := range []int{0, 5, 1} {
+		n := enode.MustParse(nodeInfos[i].url)
+		disc.dead[n.ID()] = i != 1
+		disc.nodes = append(disc.nodes, n)
+	}
+	c := startFake(&Config{CheckLiveness: true, Filters: []Filter{HasKey("attnets")}}, disc)
+	defer c.Stop()
+	sub, err := c.Subscribe(&SubscribeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := <-sub.Events()
+	if ev.Type != EventNodeFound || ev.Node.ID() != disc.nodes[2].ID() {
+		t.Fatalf("wrong event: %v", ev.Type)
+	}
+	if s := c.Stats(); s.Filtered != 2 || s.Dead != 0 {
+		t.Errorf("wrong stats: %+v", s)
+	}
+}
@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	crand "crypto/rand"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/session"
+)
+
+const (
+	// The maximum number of nodes found before which are kept as the seeds
+	// of the lookups, besides the boot nodes.
+	maxSeeds = 1000
+	// The number of those nodes used in each lookup.
+	seedsPerLookup = 16
+	// The time to wait before the next lookup when a lookup finds nothing.
+	lookupRetryDelay = time.Second
+)
+
+// sessionDisc is the discv5 instance used with a custom protocol ID, which
+// discover.UDPv5 doesn't support. It finds the nodes by doing lookups for
+// random targets with session.Client.
+type sessionDisc struct {
+	client    *session.Client
+	bootNodes []*enode.Node
+
+	lock sync.Mutex
+	// The nodes found in the previous lookups.
+	seeds []*enode.Node
+	// Closed when the instance is closed.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSessionDisc(client *session.Client, bootNodes []*enode.Node) *sessionDisc {
+	return &sessionDisc{
+		client:    client,
+		bootNodes: bootNodes,
+		closed:    make(chan struct{}),
+	}
+}
+
+func (d *sessionDisc) RandomNodes() enode.Iterator {
+	return &lookupIterator{d: d, closed: make(chan struct{})}
+}
+
+func (d *sessionDisc) RequestENR(n *enode.Node) (*enode.Node, error) {
+	return d.client.RequestENR(n)
+}
+
+func (d *sessionDisc) Close() {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		d.client.Close()
+	})
+}
+
+// lookup does a lookup for a random target and returns all the nodes found
+// in its queries.
+func (d *sessionDisc) lookup() []*enode.Node {
+	var target enode.ID
+	crand.Read(target[:])
+
+	d.lock.Lock()
+	seeds := append([]*enode.Node(nil), d.bootNodes...)
+	// Start from a few of the nodes found before, so that the lookups don't
+	// always go through the boot nodes.
+	for _, i := range rand.Perm(len(d.seeds)) {
+		if len(seeds) >= len(d.bootNodes)+seedsPerLookup {
+			break
+		}
+		seeds = append(seeds, d.seeds[i])
+	}
+	d.lock.Unlock()
+
+	seen := make(map[enode.ID]bool)
+	var found []*enode.Node
+	d.client.Lookup(target, seeds, func(q *session.Query) {
+		for _, n := range q.Found {
+			if !seen[n.ID()] {
+				seen[n.ID()] = true
+				found = append(found, n)
+			}
+		}
+	})
+
+	d.lock.Lock()
+	for _, n := range found {
+		if len(d.seeds) < maxSeeds {
+			d.seeds = append(d.seeds, n)
+		} else {
+			d.seeds[rand.Intn(maxSeeds)] = n
+		}
+	}
+	d.lock.Unlock()
+	return found
+}
+
+// lookupIterator is the iterator of sessionDisc. It does the lookups one by
+// one and iterates the nodes found in them.
+type lookupIterator struct {
+	d      *sessionDisc
+	buf    []*enode.Node
+	cur    *enode.Node
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (it *lookupIterator) Next() bool {
+	// Don't wait before the first lookup, but don't spin either when all the
+	// seeds are unreachable.
+	var delay time.Duration
+	for {
+		select {
+		case <-it.closed:
+			return false
+		case <-it.d.closed:
+			return false
+		default:
+		}
+		if len(it.buf) > 0 {
+			it.cur, it.buf = it.buf[0], it.buf[1:]
+			return true
+		}
+		select {
+		case <-it.closed:
+			return false
+		case <-it.d.closed:
+			return false
+		case <-time.After(delay):
+		}
+		it.buf = it.d.lookup()
+		delay = lookupRetryDelay
+	}
+}
+
+func (it *lookupIterator) Node() *enode.Node {
+	return it.cur
+}
+
+func (it *lookupIterator) Close() {
+	it.once.Do(func() { close(it.closed) })
+}
@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/internal/testnode"
+	"github.com/ppopth/discv5-tools/session"
+)
+
+func TestSessionDisc(t *testing.T) {
+	boot := testnode.StartV5(t, nil).Self()
+	want := make(map[enode.ID]bool)
+	for i := 0; i < 5; i++ {
+		disc := testnode.StartV5(t, []*enode.Node{boot})
+		// Make the bootnode know the node.
+		if err := disc.Ping(boot); err != nil {
+			t.Fatal(err)
+		}
+		want[disc.Self().ID()] = true
+	}
+	client, err := session.Listen(&session.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newSessionDisc(client, []*enode.Node{boot})
+	defer d.Close()
+
+	iter := d.RandomNodes()
+	defer iter.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(want) > 0 && time.Now().Before(deadline) && iter.Next() {
+		delete(want, iter.Node().ID())
+	}
+	if len(want) > 0 {
+		t.Errorf("%d nodes aren't found", len(want))
+	}
+
+	// The iterator stops when the instance is closed.
+	d.Close()
+	if iter.Next() {
+		t.Error("the iterator doesn't stop after the instance is closed")
+	}
+}
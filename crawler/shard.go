@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// instance is a discv5 instance of the crawler.
+type instance struct {
+	// The counters are accessed atomically, so they are put first to be
+	// 64-bit aligned.
+	stats Stats
+
+	index int
+	// The interface used to communicate with the ethereum DHT.
+	disc discv5
+	// The private key used to run the ethereum node.
+	privateKey *ecdsa.PrivateKey
+}
+
+func randomKeys(n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		// We can ignore an error over here, because it's just a key
+		// generation and there will be no error.
+		keys[i], _ = crypto.GenerateKey()
+	}
+	return keys
+}
+
+// spreadKeys generates the keys whose node IDs are evenly spread in the
+// keyspace. The first byte of the i-th node ID is i*256/n, so it takes about
+// 256 tries for each key. With more than 256 keys, some of them share the
+// first byte.
+func spreadKeys(n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		want := byte(i * 256 / n)
+		for {
+			key, _ := crypto.GenerateKey()
+			if enode.PubkeyToIDV4(&key.PublicKey)[0] == want {
+				keys[i] = key
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// IDs returns the node IDs of the instances.
+func (c *Crawler) IDs() []enode.ID {
+	ids := make([]enode.ID, len(c.instances))
+	for i, inst := range c.instances {
+		ids[i] = enode.PubkeyToIDV4(&inst.privateKey.PublicKey)
+	}
+	return ids
+}
+
+// InstanceStats returns the current counters of each instance.
+func (c *Crawler) InstanceStats() []Stats {
+	stats := make([]Stats, len(c.instances))
+	for i, inst := range c.instances {
+		stats[i] = inst.stats.load()
+	}
+	return stats
+}
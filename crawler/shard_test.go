@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func TestSpreadKeys(t *testing.T) {
+	c := New(&Config{Instances: 4, SpreadKeys: true})
+	ids := c.IDs()
+	if len(ids) != 4 {
+		t.Fatalf("got %d instances, want 4", len(ids))
+	}
+	for i, id := range ids {
+		if want := byte(i * 64); id[0] != want {
+			t.Errorf("instance %d has the ID %s, want the first byte %#x", i, id.TerminalString(), want)
+		}
+	}
+}
+
+func TestShards(t *testing.T) {
+	// Both instances find the first node, which is sent out only once.
+	first, second := &fakeDisc{}, &fakeDisc{}
+	for _, info := range nodeInfos[:2] {
+		first.nodes = append(first.nodes, enode.MustParse(info.url))
+	}
+	second.nodes = []*enode.Node{first.nodes[0], enode.MustParse(nodeInfos[2].url)}
+	c := startFake(&Config{Dedup: true}, first, second)
+	defer c.Stop()
+
+	found := make(map[enode.ID]bool)
+	for i := 0; i < 3; i++ {
+		nd, err := c.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found[nd.ID()] {
+			t.Errorf("the node %s is sent out twice", nd.ID().TerminalString())
+		}
+		found[nd.ID()] = true
+	}
+	if s := c.Stats(); s.Found != 4 {
+		t.Errorf("found %d nodes in total, want 4", s.Found)
+	}
+	for i, s := range c.InstanceStats() {
+		if s.Found != 2 {
+			t.Errorf("instance %d found %d nodes, want 2", i, s.Found)
+		}
+	}
+}
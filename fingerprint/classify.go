@@ -0,0 +1,146 @@
+package fingerprint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Client names.
+const (
+	Lighthouse = "lighthouse"
+	Prysm      = "prysm"
+	Teku       = "teku"
+	Nimbus     = "nimbus"
+	Lodestar   = "lodestar"
+	Geth       = "geth"
+	Unknown    = "unknown"
+)
+
+var clients = []string{Lighthouse, Prysm, Teku, Nimbus, Lodestar, Geth}
+
+// geth packs at most three nodes in a NODES packet. Prysm uses the discv5
+// package of geth, so it does the same.
+const gethNodesPerPacket = 3
+
+// The responses of the discv5 package of geth (v1.10.18) to the probed
+// conformance cases.
+var gethCaseResponses = map[string][]string{
+	"future-version":   {"whoareyou"},
+	"oversized-packet": {"whoareyou"},
+	"replayed-nonce":   {"whoareyou", "whoareyou"},
+}
+
+// Signature is a rule which recognizes a client from the traits.
+type Signature struct {
+	Client string
+	Reason string
+	Match  func(t *Traits) bool
+}
+
+// Signatures are checked in order and the first match wins. The rules other
+// than the "client" entry are heuristics and should be calibrated against
+// nodes whose clients are known.
+var Signatures = []Signature{
+	{
+		Client: Prysm,
+		Reason: "geth discv5 behavior with an eth2 entry",
+		Match: func(t *Traits) bool {
+			return gethLike(t) && t.HasKey("eth2")
+		},
+	},
+	{
+		Client: Geth,
+		Reason: "geth discv5 behavior with an eth entry",
+		Match: func(t *Traits) bool {
+			return gethLike(t) && t.HasKey("eth")
+		},
+	},
+	{
+		Client: Nimbus,
+		Reason: "three nodes per NODES packet like geth, but other responses to the malformed packets",
+		Match: func(t *Traits) bool {
+			return packsLikeGeth(t) && len(t.CaseResponses) > 0 && !answersLikeGeth(t) && t.HasKey("eth2")
+		},
+	},
+	{
+		Client: Lighthouse,
+		Reason: "eth2 and quic entries with more than three nodes per NODES packet",
+		Match: func(t *Traits) bool {
+			return t.HasKey("eth2") && t.HasKey("quic") && t.MaxNodesPerPacket > gethNodesPerPacket
+		},
+	},
+	{
+		Client: Lighthouse,
+		Reason: "more than three nodes per NODES packet, one challenge at a time and our record remembered",
+		Match: func(t *Traits) bool {
+			return t.HasKey("eth2") && t.MaxNodesPerPacket > gethNodesPerPacket && limitsChallenges(t) && t.RemembersRecord()
+		},
+	},
+	{
+		Client: Lodestar,
+		Reason: "more than three nodes per NODES packet, one challenge at a time and our record not remembered",
+		Match: func(t *Traits) bool {
+			return t.HasKey("eth2") && t.MaxNodesPerPacket > gethNodesPerPacket && limitsChallenges(t) && !t.RemembersRecord()
+		},
+	},
+	{
+		Client: Teku,
+		Reason: "more than three nodes per NODES packet and a challenge for every packet of a burst",
+		Match: func(t *Traits) bool {
+			return t.HasKey("eth2") && t.MaxNodesPerPacket > gethNodesPerPacket && !limitsChallenges(t)
+		},
+	},
+}
+
+// gethLike reports whether the node behaves like the discv5 package of geth.
+// The packing limit is only observable if the node returned enough nodes. geth
+// doesn't always remember our record, because it may not have room in its
+// table, so RemembersRecord isn't required.
+func gethLike(t *Traits) bool {
+	return packsLikeGeth(t) && answersLikeGeth(t)
+}
+
+// packsLikeGeth reports whether the node packs at most three nodes in a NODES
+// packet.
+func packsLikeGeth(t *Traits) bool {
+	return t.MaxNodesPerPacket == gethNodesPerPacket && t.NodesPackets > 1
+}
+
+// answersLikeGeth reports whether the node answers the probed conformance
+// cases as geth does. The cases which couldn't be probed are skipped.
+func answersLikeGeth(t *Traits) bool {
+	for name, got := range t.CaseResponses {
+		want, ok := gethCaseResponses[name]
+		if ok && strings.Join(got, ",") != strings.Join(want, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// limitsChallenges reports whether the node answered fewer than half of the
+// packets of the burst, i.e. it keeps one WHOAREYOU challenge pending for us
+// instead of answering every packet.
+func limitsChallenges(t *Traits) bool {
+	return t.BurstResponses < burstSize/2
+}
+
+// Classify guesses the client from the traits and returns the reason of the
+// guess. The "client" entry of the record is trusted if it names a known
+// client.
+func Classify(t *Traits) (string, string) {
+	if len(t.ClientInfo) > 0 {
+		name := strings.ToLower(t.ClientInfo[0])
+		for _, client := range clients {
+			if strings.Contains(name, client) {
+				return client, fmt.Sprintf("client entry %q", strings.Join(t.ClientInfo, "/"))
+			}
+		}
+	}
+	for _, s := range Signatures {
+		if s.Match(t) {
+			return s.Client, s.Reason
+		}
+	}
+	return Unknown, "no signature matched"
+}
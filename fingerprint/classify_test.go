@@ -0,0 +1,143 @@
+package fingerprint
+
+import "testing"
+
+// gethTraits returns the traits of a geth node with the given record keys.
+func gethTraits(keys ...string) *Traits {
+	return &Traits{
+		RecordSeqAfter:    1,
+		CaseResponses:     gethCaseResponses,
+		MaxNodesPerPacket: 3,
+		NodesPackets:      5,
+		BurstResponses:    burstSize,
+		RecordKeys:        keys,
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		traits *Traits
+		want   string
+	}{
+		{
+			name:   "client entry",
+			traits: &Traits{ClientInfo: []string{"Teku", "v22.6.1"}},
+			want:   Teku,
+		},
+		{
+			name:   "unknown client entry",
+			traits: &Traits{ClientInfo: []string{"grandine"}},
+			want:   Unknown,
+		},
+		{
+			name:   "prysm",
+			traits: gethTraits("eth2", "secp256k1"),
+			want:   Prysm,
+		},
+		{
+			name:   "geth",
+			traits: gethTraits("eth", "secp256k1"),
+			want:   Geth,
+		},
+		{
+			name: "geth without the case responses",
+			traits: &Traits{
+				CaseResponses:     map[string][]string{},
+				MaxNodesPerPacket: 3,
+				NodesPackets:      2,
+				RecordKeys:        []string{"eth"},
+			},
+			want: Geth,
+		},
+		{
+			name: "geth packing with one NODES packet",
+			traits: &Traits{
+				MaxNodesPerPacket: 3,
+				NodesPackets:      1,
+				RecordKeys:        []string{"eth"},
+			},
+			want: Unknown,
+		},
+		{
+			name: "nimbus",
+			traits: &Traits{
+				CaseResponses:     map[string][]string{"future-version": {}, "replayed-nonce": {"whoareyou"}},
+				MaxNodesPerPacket: 3,
+				NodesPackets:      4,
+				BurstResponses:    burstSize,
+				RecordKeys:        []string{"eth2"},
+			},
+			want: Nimbus,
+		},
+		{
+			name: "lighthouse with a quic entry",
+			traits: &Traits{
+				MaxNodesPerPacket: 5,
+				NodesPackets:      4,
+				BurstResponses:    burstSize,
+				RecordKeys:        []string{"eth2", "quic"},
+			},
+			want: Lighthouse,
+		},
+		{
+			name: "lighthouse",
+			traits: &Traits{
+				RecordSeqAfter:    1,
+				MaxNodesPerPacket: 5,
+				NodesPackets:      4,
+				BurstResponses:    1,
+				RecordKeys:        []string{"eth2"},
+			},
+			want: Lighthouse,
+		},
+		{
+			name: "lodestar",
+			traits: &Traits{
+				MaxNodesPerPacket: 5,
+				NodesPackets:      4,
+				BurstResponses:    1,
+				RecordKeys:        []string{"eth2"},
+			},
+			want: Lodestar,
+		},
+		{
+			name: "teku",
+			traits: &Traits{
+				MaxNodesPerPacket: 16,
+				NodesPackets:      1,
+				BurstResponses:    burstSize - 1,
+				RecordKeys:        []string{"eth2"},
+			},
+			want: Teku,
+		},
+		{
+			name:   "no eth2 entry",
+			traits: &Traits{MaxNodesPerPacket: 16, NodesPackets: 1, BurstResponses: burstSize},
+			want:   Unknown,
+		},
+	}
+	for _, test := range tests {
+		got, reason := Classify(test.traits)
+		if got != test.want {
+			t.Errorf("%s: got %s (%s), want %s", test.name, got, reason, test.want)
+		}
+	}
+}
+
+func TestRemembersRecord(t *testing.T) {
+	tests := []struct {
+		before, after uint64
+		want          bool
+	}{
+		{0, 0, false},
+		{0, 3, true},
+		{3, 3, false},
+	}
+	for _, test := range tests {
+		tr := &Traits{RecordSeqBefore: test.before, RecordSeqAfter: test.after}
+		if got := tr.RemembersRecord(); got != test.want {
+			t.Errorf("RemembersRecord() with seq %d and %d = %v, want %v", test.before, test.after, got, test.want)
+		}
+	}
+}
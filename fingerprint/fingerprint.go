@@ -0,0 +1,262 @@
+// Package fingerprint guesses the client implementation of a node from how it
+// behaves on the wire.
+package fingerprint
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/conformance"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/record"
+	"github.com/ppopth/discv5-tools/session"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+const (
+	// The number of random packets sent at once to see if the node limits the
+	// WHOAREYOU responses.
+	burstSize = 16
+	// The time to wait for the responses of the probes.
+	probeTimeout = 1 * time.Second
+)
+
+// The distance asked to see how the node packs the NODES responses. Half of
+// the keyspace is at this distance, so the node usually has many nodes there.
+var findnodeDistances = []uint{256}
+
+// The conformance cases whose responses differ among the implementations.
+var probeCases = []string{"future-version", "oversized-packet", "replayed-nonce"}
+
+// Traits are the observed behaviors of a node.
+type Traits struct {
+	// The record seq in the WHOAREYOU challenge before and after we do a
+	// handshake. Some implementations remember our record after the handshake
+	// and put its seq in the later challenges.
+	RecordSeqBefore uint64
+	RecordSeqAfter  uint64
+	// The kinds of the responses to some of the conformance cases.
+	CaseResponses map[string][]string
+	// The maximum number of nodes in one NODES packet and the number of NODES
+	// packets for one FINDNODE.
+	MaxNodesPerPacket int
+	NodesPackets      int
+	// The number of WHOAREYOU responses to a burst of random packets.
+	BurstResponses int
+	// The keys of the node record and the value of the "client" entry, if
+	// there is one.
+	RecordKeys []string
+	ClientInfo []string
+
+	// The errors of the probes which couldn't be done.
+	Errors []string
+}
+
+// RemembersRecord reports whether the node put the seq of our record in the
+// challenge after the handshake.
+func (t *Traits) RemembersRecord() bool {
+	return t.RecordSeqBefore == 0 && t.RecordSeqAfter != 0
+}
+
+// HasKey reports whether the node record has the key.
+func (t *Traits) HasKey(key string) bool {
+	for _, k := range t.RecordKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint is the result of fingerprinting a node.
+type Fingerprint struct {
+	Node   *enode.Node
+	Traits *Traits
+	// The guessed client and the reason of the guess.
+	Client string
+	Reason string
+}
+
+func (f *Fingerprint) String() string {
+	return fmt.Sprintf("id=%s addr=%v:%d client=%s reason=%q",
+		f.Node.ID().TerminalString(), f.Node.IP(), f.Node.UDP(), f.Client, f.Reason)
+}
+
+// Prober probes the nodes. It can be used from multiple routines.
+type Prober struct {
+	// The client used only by the bursts.
+	mc *measure.Client
+	sc *session.Client
+	// Held during a burst. The bursts are done one at a time, so that the
+	// packets of a burst aren't held back by the request slots of mc taken
+	// by the bursts to the other nodes.
+	burstLock sync.Mutex
+}
+
+func NewProber() (*Prober, error) {
+	// The probes aren't spaced out, because the burst probe needs to send
+	// the packets at once.
+	mc, err := measure.Listen(&measure.Config{NodeInterval: -1, IPInterval: -1, PacketsPerSecond: -1})
+	if err != nil {
+		return nil, err
+	}
+	sc, err := session.Listen(&session.Config{Timeout: probeTimeout})
+	if err != nil {
+		mc.Close()
+		return nil, err
+	}
+	return &Prober{mc: mc, sc: sc}, nil
+}
+
+func (p *Prober) Close() {
+	p.mc.Close()
+	p.sc.Close()
+}
+
+// Fingerprint probes the node and classifies it.
+func (p *Prober) Fingerprint(nd *enode.Node) *Fingerprint {
+	traits := p.Probe(nd)
+	client, reason := Classify(traits)
+	return &Fingerprint{Node: nd, Traits: traits, Client: client, Reason: reason}
+}
+
+// Probe runs the behavioral tests against the node. The tests which fail are
+// recorded in Traits.Errors and the others are still done.
+func (p *Prober) Probe(nd *enode.Node) *Traits {
+	t := &Traits{CaseResponses: make(map[string][]string)}
+	addErr := func(probe string, err error) {
+		t.Errors = append(t.Errors, fmt.Sprintf("%s: %v", probe, err))
+	}
+	t.RecordKeys = record.Keys(nd.Record())
+	t.ClientInfo = record.Client(nd.Record())
+
+	if err := p.probeRecordSeq(nd, t); err != nil {
+		addErr("recordseq", err)
+	}
+	if err := p.probeCases(nd, t); err != nil {
+		addErr("cases", err)
+	}
+
+	resps, _, err := p.sc.FindnodeResponses(nd, findnodeDistances)
+	if err != nil {
+		addErr("findnode", err)
+	}
+	t.NodesPackets = len(resps)
+	for _, resp := range resps {
+		if len(resp.Nodes) > t.MaxNodesPerPacket {
+			t.MaxNodesPerPacket = len(resp.Nodes)
+		}
+	}
+
+	t.BurstResponses = p.burst(nd)
+	return t
+}
+
+// probeRecordSeq reads the record seq in the challenges before and after a
+// handshake done with the same identity.
+func (p *Prober) probeRecordSeq(nd *enode.Node, t *Traits) error {
+	tester, err := conformance.NewTester(nd, probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer tester.Close()
+
+	before, err := challengeSeq(tester)
+	if err != nil {
+		return err
+	}
+	t.RecordSeqBefore = before
+	c, _ := conformance.CaseByName("valid-handshake")
+	if r := tester.Run(c); r.Err != nil || !r.Conforming {
+		return fmt.Errorf("handshake failed")
+	}
+	after, err := challengeSeq(tester)
+	if err != nil {
+		return err
+	}
+	t.RecordSeqAfter = after
+	return nil
+}
+
+func challengeSeq(tester *conformance.Tester) (uint64, error) {
+	head, err := tester.Challenge()
+	if err != nil {
+		return 0, err
+	}
+	auth, err := wire.DecodeWhoareyouAuthData(head)
+	if err != nil {
+		return 0, err
+	}
+	return auth.RecordSeq, nil
+}
+
+// probeCases runs the conformance cases whose responses are left to the
+// implementation.
+func (p *Prober) probeCases(nd *enode.Node, t *Traits) error {
+	for _, name := range probeCases {
+		c, _ := conformance.CaseByName(name)
+		r, err := conformance.Run(nd, c, probeTimeout)
+		if err != nil {
+			return err
+		}
+		if r.Err != nil {
+			return fmt.Errorf("%s: %v", name, r.Err)
+		}
+		t.CaseResponses[name] = r.Responses
+	}
+	return nil
+}
+
+// burst sends random packets at once and counts the WHOAREYOU responses.
+func (p *Prober) burst(nd *enode.Node) int {
+	p.burstLock.Lock()
+	defer p.burstLock.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+	)
+	for i := 0; i < burstSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := p.mc.SendTimeout(nd, probeTimeout); err == nil {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return count
+}
+
+// Census counts the nodes of each client.
+type Census map[string]int
+
+func NewCensus(fps []*Fingerprint) Census {
+	c := make(Census)
+	for _, f := range fps {
+		c[f.Client]++
+	}
+	return c
+}
+
+// Clients returns the clients sorted by the number of nodes.
+func (c Census) Clients() []string {
+	var clients []string
+	for client := range c {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if c[clients[i]] != c[clients[j]] {
+			return c[clients[i]] > c[clients[j]]
+		}
+		return clients[i] < clients[j]
+	})
+	return clients
+}
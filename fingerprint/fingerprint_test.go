@@ -0,0 +1,52 @@
+package fingerprint
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/internal/testnode"
+)
+
+// TestConcurrentBursts fingerprints several nodes at the same time, some of
+// which are gone and hold the request slots until the timeout, and checks
+// that every burst to a live node is answered in full, as geth answers every
+// packet.
+func TestConcurrentBursts(t *testing.T) {
+	p, err := NewProber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var nodes []*enode.Node
+	for i := 0; i < 8; i++ {
+		nodes = append(nodes, testnode.StartV5(t, nil).Self())
+	}
+	live := len(nodes)
+	for i := 0; i < 2; i++ {
+		disc := testnode.StartV5(t, nil)
+		disc.Close()
+		nodes = append(nodes, disc.Self())
+	}
+	fps := make([]*Fingerprint, len(nodes))
+	var wg sync.WaitGroup
+	for i, nd := range nodes {
+		wg.Add(1)
+		go func(i int, nd *enode.Node) {
+			defer wg.Done()
+			fps[i] = p.Fingerprint(nd)
+		}(i, nd)
+	}
+	wg.Wait()
+
+	for i, fp := range fps {
+		want := burstSize
+		if i >= live {
+			want = 0
+		}
+		if fp.Traits.BurstResponses != want {
+			t.Errorf("%v: got %d burst responses, want %d", fp.Node.ID().TerminalString(), fp.Traits.BurstResponses, want)
+		}
+	}
+}
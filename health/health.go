@@ -0,0 +1,156 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/session"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+// The distances asked in the FINDNODE check. A node with a non-empty table
+// almost surely has nodes at these distances.
+var findnodeDistances = []uint{256, 255, 254}
+
+// Status is the result of checking a node.
+type Status struct {
+	Node *enode.Node
+
+	// If the node answers a random packet with a WHOAREYOU packet.
+	Whoareyou    bool
+	WhoareyouRtt time.Duration
+	// If the handshake with the node succeeds. It's checked by sending PING.
+	Handshake    bool
+	HandshakeRtt time.Duration
+	// If the node answers FINDNODE and returns at least one node.
+	Findnode      bool
+	FindnodeCount int
+	// The current record of the node, if it can be requested.
+	CurrentNode *enode.Node
+
+	// The first error found during the check.
+	Err error
+}
+
+// Healthy reports whether the node can be used to bootstrap the network.
+func (s *Status) Healthy() bool {
+	return s.Whoareyou && s.Handshake && s.Findnode
+}
+
+// Fresh reports whether the record we have is the current record of the
+// node. It's false if the record can't be requested.
+func (s *Status) Fresh() bool {
+	return s.CurrentNode != nil && s.CurrentNode.Seq() <= s.Node.Seq()
+}
+
+func (s *Status) String() string {
+	str := fmt.Sprintf("id=%s addr=%v:%d", s.Node.ID().TerminalString(), s.Node.IP(), s.Node.UDP())
+	if s.Whoareyou {
+		str += fmt.Sprintf(" whoareyou=ok(%v)", s.WhoareyouRtt)
+	} else {
+		str += " whoareyou=fail"
+	}
+	if s.Handshake {
+		str += fmt.Sprintf(" handshake=ok(%v)", s.HandshakeRtt)
+	} else {
+		str += " handshake=fail"
+	}
+	if s.Findnode {
+		str += fmt.Sprintf(" findnode=ok(%d nodes)", s.FindnodeCount)
+	} else {
+		str += fmt.Sprintf(" findnode=fail(%d nodes)", s.FindnodeCount)
+	}
+	switch {
+	case s.CurrentNode == nil:
+		str += " enr=unknown"
+	case s.Fresh():
+		str += " enr=fresh"
+	default:
+		str += fmt.Sprintf(" enr=stale(seq %d -> %d)", s.Node.Seq(), s.CurrentNode.Seq())
+	}
+	if s.Err != nil {
+		str += fmt.Sprintf(" error=%q", s.Err)
+	}
+	return str
+}
+
+// Check checks the node using the given clients. The WHOAREYOU check comes
+// first because it doesn't need a handshake.
+func Check(mc *measure.Client, sc *session.Client, nd *enode.Node) *Status {
+	s := &Status{Node: nd}
+	setErr := func(err error) {
+		if s.Err == nil {
+			s.Err = err
+		}
+	}
+
+	_, rtt, err := mc.Send(nd)
+	if err != nil {
+		setErr(fmt.Errorf("whoareyou: %v", err))
+	} else {
+		s.Whoareyou = true
+		s.WhoareyouRtt = rtt
+	}
+
+	_, rtt, err = sc.Ping(nd)
+	if err != nil {
+		setErr(fmt.Errorf("handshake: %v", err))
+		return s
+	}
+	s.Handshake = true
+	s.HandshakeRtt = rtt
+
+	nodes, _, err := sc.Findnode(nd, findnodeDistances)
+	s.FindnodeCount = len(nodes)
+	if err != nil {
+		setErr(fmt.Errorf("findnode: %v", err))
+	} else if len(nodes) == 0 {
+		setErr(fmt.Errorf("findnode: no nodes returned"))
+	} else {
+		s.Findnode = true
+	}
+
+	cur, err := sc.RequestENR(nd)
+	if err != nil {
+		setErr(fmt.Errorf("enr: %v", err))
+	} else {
+		s.CurrentNode = cur
+	}
+	return s
+}
+
+// CheckAll checks all the nodes concurrently and returns the statuses in the
+// same order as the nodes.
+func CheckAll(nodes []*enode.Node) ([]*Status, error) {
+	return CheckAllProtocol(nodes, wire.DefaultProtocolID())
+}
+
+// CheckAllProtocol is like CheckAll, but the nodes are checked with the given
+// protocol ID.
+func CheckAllProtocol(nodes []*enode.Node, protocolID [6]byte) ([]*Status, error) {
+	mc, err := measure.Listen(&measure.Config{ProtocolID: protocolID})
+	if err != nil {
+		return nil, err
+	}
+	defer mc.Close()
+	sc, err := session.Listen(&session.Config{ProtocolID: protocolID})
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+
+	statuses := make([]*Status, len(nodes))
+	var wg sync.WaitGroup
+	for i, nd := range nodes {
+		wg.Add(1)
+		go func(i int, nd *enode.Node) {
+			defer wg.Done()
+			statuses[i] = Check(mc, sc, nd)
+		}(i, nd)
+	}
+	wg.Wait()
+	return statuses, nil
+}
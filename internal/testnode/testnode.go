@@ -0,0 +1,37 @@
+// Package testnode starts the discovery nodes used by the tests.
+package testnode
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// StartV5 starts a discv5 node listening on the loopback interface. The node
+// is closed when the test finishes.
+func StartV5(t testing.TB, bootNodes []*enode.Node) *discover.UDPv5 {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := enode.NewLocalNode(db, key)
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(socket.LocalAddr().(*net.UDPAddr).Port)
+	disc, err := discover.ListenV5(socket, ln, discover.Config{PrivateKey: key, Bootnodes: bootNodes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(disc.Close)
+	return disc
+}
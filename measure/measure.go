@@ -1,11 +1,14 @@
 package measure
 
 import (
+	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -15,41 +18,135 @@ import (
 const (
 	maxPacketSize = 1280
 	maxRequests   = 50
-	numAttempts   = 100
-	timeout       = 3 * time.Second
+)
+
+const (
+	// NumAttempts is the number of packets sent to a node by Run.
+	NumAttempts = 100
+	// Timeout is the time to wait for the response of each packet.
+	Timeout = 3 * time.Second
+)
+
+// The discovery protocols which the nodes can be measured with.
+const (
+	Discv5 = "discv5"
+	Discv4 = "discv4"
 )
 
 var (
-	errTimeout = errors.New("the request reached the timeout")
+	ErrTimeout = errors.New("the request reached the timeout")
+	errClosed  = errors.New("the client is closed")
+	// Returned by the measurements which only work with discv5.
+	errNotDiscv5 = errors.New("the measurement needs discv5")
 )
 
 type Result struct {
 	Rtt      time.Duration
 	LossRate float64
+	// The last WHOAREYOU or PONG received during the measurement, depending
+	// on the protocol.
+	Whoareyou *Whoareyou `json:",omitempty"`
+	Pong      *Pong      `json:",omitempty"`
+	// The result of probing the node at increasing rates, if it's done.
+	Throttle *Throttle `json:",omitempty"`
+	// The result of probing the node with increasing packet sizes, if it's
+	// done.
+	Sizes *SizeSweep `json:",omitempty"`
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("{%v %v", r.Rtt, r.LossRate)
+	if r.Whoareyou != nil {
+		s += " " + r.Whoareyou.String()
+	}
+	if r.Pong != nil {
+		s += " " + r.Pong.String()
+	}
+	if r.Throttle != nil {
+		s += " " + r.Throttle.String()
+	}
+	if r.Sizes != nil {
+		s += " " + r.Sizes.String()
+	}
+	return s + "}"
+}
+
+// Whoareyou is a decoded WHOAREYOU response.
+type Whoareyou struct {
+	Header *v5wire.Header `json:"-"`
+	// The ID nonce of the challenge.
+	IDNonce hexutil.Bytes
+	// The seq of our record which the responder knows. It's zero if the
+	// responder doesn't know our record.
+	RecordSeq uint64
+	// The address which the response comes from.
+	From *net.UDPAddr
+}
+
+// StaleEndpoint reports whether the response comes from an address other
+// than the endpoint in the record of the node. If it does, the node is alive,
+// but the record doesn't tell where it is.
+func (w *Whoareyou) StaleEndpoint(nd *enode.Node) bool {
+	return !w.From.IP.Equal(nd.IP()) || w.From.Port != nd.UDP()
+}
+
+func (w *Whoareyou) String() string {
+	return fmt.Sprintf("from=%v record-seq=%d id-nonce=%v", w.From, w.RecordSeq, w.IDNonce)
+}
+
+// From returns the address which the last response comes from, or nil if
+// there is no response.
+func (r *Result) From() *net.UDPAddr {
+	switch {
+	case r.Whoareyou != nil:
+		return r.Whoareyou.From
+	case r.Pong != nil:
+		return r.Pong.From
+	}
+	return nil
+}
+
+// StaleEndpoint reports whether the last response comes from an address
+// other than the endpoint in the record of the node.
+func (r *Result) StaleEndpoint(nd *enode.Node) bool {
+	from := r.From()
+	return from != nil && (!from.IP.Equal(nd.IP()) || from.Port != nd.UDP())
 }
 
 type call struct {
 	nd     *enode.Node
 	head   *v5wire.Header
-	respCh chan<- *v5wire.Header
+	respCh chan<- *Whoareyou
 }
 
 type Client struct {
-	ln      *enode.LocalNode
-	usocket *net.UDPConn
+	protocol   string
+	protocolID [6]byte
+	privateKey *ecdsa.PrivateKey
+	ln         *enode.LocalNode
+	usocket    *net.UDPConn
 	// Used to access activeCallByNonce from multiple routines.
 	lock sync.Mutex
 	// The map used to find the active call by the nonce.
 	activeCallByNonce map[v5wire.Nonce]call
+	// The map used to find the active discv4 call by the hash of the PING.
+	activePingByHash map[string]chan<- *Pong
 	// The semaphore to limit the number of active calls.
 	semaphore chan interface{}
+	// Used to space out the probes.
+	sched *scheduler
 	// Shutdown stuff.
 	closeOnce sync.Once
+	closed    chan struct{}
 	// Used to wait for the goroutines to finish.
 	loopWG sync.WaitGroup
 }
 
-func Listen() (*Client, error) {
+func Listen(config *Config) (*Client, error) {
+	cfg := config.withDefaults()
+	if cfg.Protocol != Discv5 && cfg.Protocol != Discv4 {
+		return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
+	}
 	privateKey, err := crypto.GenerateKey()
 	if err != nil {
 		return nil, err
@@ -73,11 +170,17 @@ func Listen() (*Client, error) {
 	usocket := socket.(*net.UDPConn)
 
 	client := &Client{
-		ln:      ln,
-		usocket: usocket,
+		protocol:   cfg.Protocol,
+		protocolID: cfg.ProtocolID,
+		privateKey: privateKey,
+		ln:         ln,
+		usocket:    usocket,
 
 		activeCallByNonce: make(map[v5wire.Nonce]call),
+		activePingByHash:  make(map[string]chan<- *Pong),
 		semaphore:         make(chan interface{}, maxRequests),
+		sched:             newScheduler(cfg),
+		closed:            make(chan struct{}),
 	}
 	client.loopWG.Add(1)
 	go client.readLoop()
@@ -85,21 +188,30 @@ func Listen() (*Client, error) {
 	return client, nil
 }
 
+// Self returns the record of the local node.
+func (c *Client) Self() *enode.Node {
+	return c.ln.Node()
+}
+
 func (c *Client) readLoop() {
 	defer c.loopWG.Done()
 	buf := make([]byte, maxPacketSize)
 	for {
-		nbytes, _, err := c.usocket.ReadFromUDP(buf)
+		nbytes, from, err := c.usocket.ReadFromUDP(buf)
 		if err != nil {
 			return
 		}
 		content := buf[:nbytes]
-		head, msgData, err := wire.DecodeRawPacket(content, c.ln.ID())
+		if c.protocol == Discv4 {
+			c.handleV4(content, from)
+			continue
+		}
+		head, msgData, err := wire.DecodeRawPacketProtocol(content, c.ln.ID(), c.protocolID)
 		if err != nil {
 			// TODO: Log the error
 			continue
 		}
-		_, err = wire.DecodeWhoareyouAuthData(head)
+		auth, err := wire.DecodeWhoareyouAuthData(head)
 		if err != nil {
 			// TODO: Log the error
 			continue
@@ -120,30 +232,73 @@ func (c *Client) readLoop() {
 			// TODO: Log the error
 			continue
 		}
-		cl.respCh <- head
+		cl.respCh <- &Whoareyou{
+			Header:    head,
+			IDNonce:   auth.IDNonce[:],
+			RecordSeq: auth.RecordSeq,
+			From:      from,
+		}
 	}
 }
 
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
+		close(c.closed)
 		c.usocket.Close()
 		c.loopWG.Wait()
 	})
 }
 
 func (c *Client) Send(nd *enode.Node) (*v5wire.Header, time.Duration, error) {
-	// Use the semaphore to limit the number of active calls.
-	c.semaphore <- struct{}{}
-	defer func() {
-		<-c.semaphore
-	}()
+	return c.SendTimeout(nd, Timeout)
+}
+
+// SendTimeout is like Send, but it waits for the response only up to the given
+// duration.
+func (c *Client) SendTimeout(nd *enode.Node, d time.Duration) (*v5wire.Header, time.Duration, error) {
+	resp, elapsed, err := c.ProbeTimeout(nd, d)
+	if err != nil {
+		return nil, elapsed, err
+	}
+	return resp.Header, elapsed, nil
+}
+
+// Probe is like Send, but it returns the decoded WHOAREYOU response.
+func (c *Client) Probe(nd *enode.Node) (*Whoareyou, time.Duration, error) {
+	return c.ProbeTimeout(nd, Timeout)
+}
+
+// ProbeTimeout is like Probe, but it waits for the response only up to the
+// given duration.
+func (c *Client) ProbeTimeout(nd *enode.Node, d time.Duration) (*Whoareyou, time.Duration, error) {
+	return c.probe(nd, wire.RandomPacketSize, d, func() time.Time { return c.sched.reserve(nd) })
+}
+
+// ProbeSizeTimeout is like ProbeTimeout, but the random packet has the given
+// size.
+func (c *Client) ProbeSizeTimeout(nd *enode.Node, size int, d time.Duration) (*Whoareyou, time.Duration, error) {
+	return c.probe(nd, size, d, func() time.Time { return c.sched.reserve(nd) })
+}
+
+// probe sends a random packet of the given size to the node at the time
+// returned by reserve and waits for the response up to the given duration.
+func (c *Client) probe(nd *enode.Node, size int, d time.Duration, reserve func() time.Time) (*Whoareyou, time.Duration, error) {
+	if c.protocol != Discv5 {
+		return nil, 0, errNotDiscv5
+	}
+	release, err := c.acquire(reserve)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
 
 	start := time.Now()
 	// Generate random packet.
-	head, msgData, err := wire.GenRandomPacket(c.ln.ID(), nd.ID())
+	head, msgData, err := wire.GenRandomPacketSize(c.ln.ID(), nd.ID(), size)
 	if err != nil {
 		return nil, time.Since(start), err
 	}
+	head.ProtocolID = c.protocolID
 
 	// Encode the raw packet which is ready to be sent.
 	encoded, err := wire.EncodeRawPacket(nd.ID(), head, msgData)
@@ -152,7 +307,9 @@ func (c *Client) Send(nd *enode.Node) (*v5wire.Header, time.Duration, error) {
 	}
 
 	c.lock.Lock()
-	ch := make(chan *v5wire.Header)
+	// The channel is buffered, so that the read loop doesn't block when the
+	// response arrives right after the timeout.
+	ch := make(chan *Whoareyou, 1)
 	cl := call{nd, &head, ch}
 	c.activeCallByNonce[head.Nonce] = cl
 	c.lock.Unlock()
@@ -164,22 +321,60 @@ func (c *Client) Send(nd *enode.Node) (*v5wire.Header, time.Duration, error) {
 	}
 
 	select {
-	case <-time.After(timeout):
+	case <-time.After(d):
 		c.lock.Lock()
 		delete(c.activeCallByNonce, head.Nonce)
 		c.lock.Unlock()
-		return nil, time.Since(start), errTimeout
-	case respHead := <-ch:
-		return respHead, time.Since(start), nil
+		return nil, time.Since(start), ErrTimeout
+	case resp := <-ch:
+		return resp, time.Since(start), nil
+	}
+}
+
+// acquire waits for the time reserved by the scheduler and then takes a slot
+// of the semaphore, which limits the number of active calls. The slot is
+// taken only after the wait, so the calls waiting for their reserved times
+// don't hold the slots needed by the calls which can go now. The waiting time
+// isn't counted in the RTT. The returned function releases the slot.
+func (c *Client) acquire(reserve func() time.Time) (func(), error) {
+	if wait := time.Until(reserve()); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-c.closed:
+			return nil, errClosed
+		}
 	}
+	select {
+	case c.semaphore <- struct{}{}:
+	case <-c.closed:
+		return nil, errClosed
+	}
+	return func() { <-c.semaphore }, nil
 }
 
+// Run measures the node by sending NumAttempts random packets with discv5, or
+// PINGs with discv4, and waiting for the responses.
 func (c *Client) Run(nd *enode.Node) (*Result, error) {
 	avgRtt := int64(0)
 	timeouts := 0
-	for i := 0; i < numAttempts; i++ {
-		_, elapsed, err := c.Send(nd)
-		if err == errTimeout {
+	result := &Result{}
+	for i := 0; i < NumAttempts; i++ {
+		var (
+			elapsed time.Duration
+			err     error
+		)
+		if c.protocol == Discv4 {
+			var pong *Pong
+			if pong, elapsed, err = c.Ping(nd); err == nil {
+				result.Pong = pong
+			}
+		} else {
+			var resp *Whoareyou
+			if resp, elapsed, err = c.Probe(nd); err == nil {
+				result.Whoareyou = resp
+			}
+		}
+		if err == ErrTimeout {
 			timeouts++
 			continue
 		} else if err != nil {
@@ -187,10 +382,12 @@ func (c *Client) Run(nd *enode.Node) (*Result, error) {
 		}
 		avgRtt += int64(elapsed)
 	}
-	avgRtt /= numAttempts
-	result := &Result{
-		Rtt:      time.Duration(avgRtt),
-		LossRate: float64(timeouts)/numAttempts,
+	// The lost packets don't have an RTT, so the average is only over the
+	// answered ones.
+	if answered := NumAttempts - timeouts; answered > 0 {
+		avgRtt /= int64(answered)
 	}
+	result.Rtt = time.Duration(avgRtt)
+	result.LossRate = float64(timeouts) / NumAttempts
 	return result, nil
 }
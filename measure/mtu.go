@@ -0,0 +1,100 @@
+package measure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+const (
+	// The number of probes sent for each packet size.
+	sizeProbes = 20
+	// The loss rate at a size may exceed the loss at the smallest size by at
+	// most this much for the size to be reliable.
+	sizeMargin = 0.2
+)
+
+// The packet sizes swept, from the smallest to the largest. 1280 bytes is the
+// maximum size of discv5 packets and also the minimum MTU of IPv6, so most of
+// the paths should pass it.
+var sweepSizes = []int{wire.MinRandomPacketSize, 200, 400, 600, 800, 1000, 1100, 1200, 1232, wire.MaxPacketSize}
+
+// SizeStep is the result of probing a node with packets of one size.
+type SizeStep struct {
+	Size     int
+	Sent     int
+	Received int
+	LossRate float64
+	// The average RTT of the answered probes.
+	Rtt time.Duration
+}
+
+// SizeSweep is the result of probing a node with packets of increasing
+// sizes.
+type SizeSweep struct {
+	Steps []SizeStep
+	// The largest size such that the node reliably answers the packets of it
+	// and all the smaller sizes. It's zero if even the smallest packets aren't
+	// answered.
+	MaxReliableSize int
+}
+
+// Truncated reports whether the packets of some sizes are lost, which
+// suggests that the path to the node drops large packets.
+func (s *SizeSweep) Truncated() bool {
+	return s.MaxReliableSize < s.Steps[len(s.Steps)-1].Size
+}
+
+func (s *SizeSweep) String() string {
+	str := fmt.Sprintf("max-reliable-size=%d", s.MaxReliableSize)
+	for _, st := range s.Steps {
+		str += fmt.Sprintf(" %d:%.2f/%v", st.Size, st.LossRate, st.Rtt)
+	}
+	return str
+}
+
+// MeasureSizes probes the node with random packets of sizes from the minimum
+// up to 1280 bytes. The WHOAREYOU responses are always small, so it checks the
+// path to the node, not the path from the node.
+func (c *Client) MeasureSizes(nd *enode.Node) (*SizeSweep, error) {
+	sweep := &SizeSweep{}
+	for _, size := range sweepSizes {
+		st := SizeStep{Size: size, Sent: sizeProbes}
+		var totalRtt time.Duration
+		for i := 0; i < sizeProbes; i++ {
+			_, rtt, err := c.ProbeSizeTimeout(nd, size, Timeout)
+			if err == ErrTimeout {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			st.Received++
+			totalRtt += rtt
+		}
+		st.LossRate = float64(st.Sent-st.Received) / float64(st.Sent)
+		if st.Received > 0 {
+			st.Rtt = totalRtt / time.Duration(st.Received)
+		}
+		sweep.Steps = append(sweep.Steps, st)
+	}
+	sweep.MaxReliableSize = maxReliableSize(sweep.Steps)
+	return sweep, nil
+}
+
+// maxReliableSize finds the largest size up to which the loss stays close to
+// the loss at the smallest size.
+func maxReliableSize(steps []SizeStep) int {
+	if steps[0].Received == 0 {
+		return 0
+	}
+	maxSize := 0
+	for _, st := range steps {
+		if st.LossRate > steps[0].LossRate+sizeMargin {
+			break
+		}
+		maxSize = st.Size
+	}
+	return maxSize
+}
@@ -0,0 +1,28 @@
+package measure
+
+import "testing"
+
+func TestMaxReliableSize(t *testing.T) {
+	steps := func(losses ...float64) []SizeStep {
+		var s []SizeStep
+		for i, loss := range losses {
+			s = append(s, SizeStep{Size: (i + 1) * 100, Sent: 20, Received: int(20 * (1 - loss)), LossRate: loss})
+		}
+		return s
+	}
+	tests := []struct {
+		steps []SizeStep
+		want  int
+	}{
+		{steps(0, 0, 0, 0), 400},
+		{steps(0.1, 0.2, 0.25, 0.1), 400},
+		{steps(0, 0, 1, 1), 200},
+		{steps(0, 0.5, 0, 0), 100},
+		{steps(1, 1, 1, 1), 0},
+	}
+	for i, test := range tests {
+		if got := maxReliableSize(test.steps); got != test.want {
+			t.Errorf("test %d: got %d, want %d", i, got, test.want)
+		}
+	}
+}
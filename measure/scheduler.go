@@ -0,0 +1,158 @@
+package measure
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+// The default limits of the scheduler. With them, a measurement of 100
+// probes to one node takes at least ten seconds.
+const (
+	DefaultNodeInterval     = 100 * time.Millisecond
+	DefaultIPInterval       = 20 * time.Millisecond
+	DefaultPacketsPerSecond = 500
+	DefaultJitter           = 0.5
+)
+
+// The number of reservations after which the expired entries are removed.
+const sweepInterval = 1024
+
+// Config is a configuration used to create Client. For each limit, zero means
+// the default value and a negative value means no limit.
+type Config struct {
+	// The minimum interval between two probes to the same node.
+	NodeInterval time.Duration
+	// The minimum interval between two probes to the same IP address. Many
+	// nodes may run behind the same address.
+	IPInterval time.Duration
+	// The maximum number of probes sent per second in total.
+	PacketsPerSecond float64
+	// The random fraction of the intervals added to them, so that the probes
+	// aren't sent at fixed times. A negative value means no jitter.
+	Jitter float64
+	// The discovery protocol, Discv5 or Discv4. If it's empty, Discv5 is
+	// used.
+	Protocol string
+	// The protocol ID in the headers of the discv5 packets. If it's zero,
+	// wire.DefaultProtocolID is used.
+	ProtocolID [6]byte
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.NodeInterval == 0 {
+		cfg.NodeInterval = DefaultNodeInterval
+	}
+	if cfg.IPInterval == 0 {
+		cfg.IPInterval = DefaultIPInterval
+	}
+	if cfg.PacketsPerSecond == 0 {
+		cfg.PacketsPerSecond = DefaultPacketsPerSecond
+	}
+	if cfg.Jitter == 0 {
+		cfg.Jitter = DefaultJitter
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = Discv5
+	}
+	if cfg.ProtocolID == ([6]byte{}) {
+		cfg.ProtocolID = wire.DefaultProtocolID()
+	}
+	return cfg
+}
+
+// scheduler decides when each probe can be sent. Every probe reserves a time
+// slot which respects all the limits, so the probes are never sent in bursts.
+type scheduler struct {
+	cfg Config
+
+	lock sync.Mutex
+	// The earliest time the next probe can be sent to each node, each IP
+	// address and anywhere.
+	nodeNext   map[enode.ID]time.Time
+	ipNext     map[string]time.Time
+	globalNext time.Time
+	// The number of reservations since the last sweep.
+	reserved int
+	rand     *rand.Rand
+}
+
+func newScheduler(cfg Config) *scheduler {
+	return &scheduler{
+		cfg:      cfg,
+		nodeNext: make(map[enode.ID]time.Time),
+		ipNext:   make(map[string]time.Time),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// reserve reserves the earliest slot to send a probe to the node and returns
+// the time of the slot.
+func (s *scheduler) reserve(nd *enode.Node) time.Time {
+	return s.reserveEvery(nd, s.jitter(s.cfg.NodeInterval), s.jitter(s.cfg.IPInterval))
+}
+
+// reserveEvery is like reserve, but the next probe to the node and to its IP
+// address can be sent after the given intervals instead of the configured
+// ones. Non-positive intervals mean no limit.
+func (s *scheduler) reserveEvery(nd *enode.Node, nodeInterval, ipInterval time.Duration) time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	ip := nd.IP().String()
+	slot := now
+	if t := s.nodeNext[nd.ID()]; t.After(slot) {
+		slot = t
+	}
+	if t := s.ipNext[ip]; t.After(slot) {
+		slot = t
+	}
+	if s.globalNext.After(slot) {
+		slot = s.globalNext
+	}
+
+	if nodeInterval > 0 {
+		s.nodeNext[nd.ID()] = slot.Add(nodeInterval)
+	}
+	if ipInterval > 0 {
+		s.ipNext[ip] = slot.Add(ipInterval)
+	}
+	if s.cfg.PacketsPerSecond > 0 {
+		s.globalNext = slot.Add(time.Duration(float64(time.Second) / s.cfg.PacketsPerSecond))
+	}
+
+	s.reserved++
+	if s.reserved >= sweepInterval {
+		s.sweep(now)
+	}
+	return slot
+}
+
+// jitter adds a random fraction of the interval to it.
+func (s *scheduler) jitter(d time.Duration) time.Duration {
+	if s.cfg.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return d + time.Duration(s.rand.Float64()*s.cfg.Jitter*float64(d))
+}
+
+// sweep removes the entries which don't limit anything anymore.
+func (s *scheduler) sweep(now time.Time) {
+	for id, t := range s.nodeNext {
+		if t.Before(now) {
+			delete(s.nodeNext, id)
+		}
+	}
+	for ip, t := range s.ipNext {
+		if t.Before(now) {
+			delete(s.ipNext, ip)
+		}
+	}
+	s.reserved = 0
+}
@@ -0,0 +1,93 @@
+package measure
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// The time allowed for the test itself to run between the reservations.
+const tolerance = 10 * time.Millisecond
+
+func testNode(t *testing.T, ip net.IP) *enode.Node {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enode.NewV4(&key.PublicKey, ip, 30303, 30303)
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	s := newScheduler(Config{
+		NodeInterval:     100 * time.Millisecond,
+		IPInterval:       10 * time.Millisecond,
+		PacketsPerSecond: -1,
+		Jitter:           -1,
+	})
+	a := testNode(t, net.IP{10, 0, 0, 1})
+	b := testNode(t, net.IP{10, 0, 0, 1})
+	c := testNode(t, net.IP{10, 0, 0, 2})
+
+	first := s.reserve(a)
+	// b has the same IP address as a.
+	if d := s.reserve(b).Sub(first); d != 10*time.Millisecond {
+		t.Errorf("the same IP address is probed after %v, want %v", d, 10*time.Millisecond)
+	}
+	if d := s.reserve(a).Sub(first); d != 100*time.Millisecond {
+		t.Errorf("the same node is probed after %v, want %v", d, 100*time.Millisecond)
+	}
+	if d := s.reserve(c).Sub(first); d > tolerance {
+		t.Errorf("an unrelated node waits for %v, want at most %v", d, tolerance)
+	}
+}
+
+func TestSchedulerGlobalRate(t *testing.T) {
+	s := newScheduler(Config{
+		NodeInterval:     -1,
+		IPInterval:       -1,
+		PacketsPerSecond: 100,
+		Jitter:           -1,
+	})
+	// The tenth probe is 90ms after the first one, less the time taken to
+	// reserve the slots.
+	const want = 90*time.Millisecond - tolerance
+	var last time.Time
+	for i := 0; i < 10; i++ {
+		last = s.reserve(testNode(t, net.IP{10, 0, 0, byte(i)}))
+	}
+	if d := time.Until(last); d < want {
+		t.Errorf("the tenth probe is sent in %v, want at least %v", d, want)
+	}
+}
+
+func TestAcquireDoesNotStarve(t *testing.T) {
+	c, err := Listen(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Fill every slot with calls waiting for their reserved times.
+	later := time.Now().Add(time.Second)
+	for i := 0; i < maxRequests; i++ {
+		go func() {
+			if release, err := c.acquire(func() time.Time { return later }); err == nil {
+				release()
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	release, err := c.acquire(time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("a call which can go now waits for %v", d)
+	}
+}
@@ -0,0 +1,210 @@
+package measure
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+// The throttling patterns.
+const (
+	PatternNone = "none"
+	// The node answers a fixed number of probes and then stays silent.
+	PatternBurst = "burst"
+	// The node answers the probes in windows separated by silences.
+	PatternWindow = "window"
+	// The responses are dropped evenly at the fast rates.
+	PatternRate = "rate"
+)
+
+const (
+	// The time to wait after each step, so that the responses of the step
+	// arrive and the limiters of the node recover before the next step.
+	stepRest = 3 * time.Second
+	// The loss rate at a fast rate must exceed the loss at the slowest rate by
+	// this much to count as throttling.
+	throttleMargin = 0.25
+)
+
+// The probe rates used to detect throttling, from the slowest to the fastest.
+// The slowest rate is assumed not to be throttled.
+var throttleSteps = []struct {
+	rate   float64
+	probes int
+}{
+	{2, 20},
+	{10, 20},
+	{50, 40},
+	{200, 40},
+}
+
+// RateStep is the result of probing a node at one rate.
+type RateStep struct {
+	// The rate the probes are actually sent at, which may be lower than the
+	// intended rate due to the global limit of the client.
+	Rate     float64
+	Sent     int
+	Received int
+	LossRate float64
+	// If each probe is answered, in the order they are sent.
+	Answered []bool `json:"-"`
+}
+
+// Throttle is the result of probing a node at increasing rates to tell
+// throttling from the loss of the network.
+type Throttle struct {
+	Steps []RateStep
+	// The loss rate at the slowest rate, which is taken as the loss of the
+	// network.
+	BaseLossRate float64
+	Throttled    bool
+	// The estimated number of responses per second the node allows us. It's
+	// zero if the node isn't throttled.
+	ThrottleRate float64
+	Pattern      string
+	// The number of responses before the first loss at the fastest throttled
+	// rate. It's the size of the burst the node allows if the pattern is
+	// burst.
+	BurstSize int
+}
+
+func (t *Throttle) String() string {
+	if !t.Throttled {
+		return fmt.Sprintf("throttled=false loss=%.2f", t.BaseLossRate)
+	}
+	return fmt.Sprintf("throttled=true loss=%.2f throttle-rate=%.1f/s pattern=%s burst=%d",
+		t.BaseLossRate, t.ThrottleRate, t.Pattern, t.BurstSize)
+}
+
+// MeasureThrottle probes the node at increasing rates and checks if the loss
+// grows with the rate. The probes of each step are sent at the rate of the
+// step regardless of the per-node and per-IP intervals of the client.
+func (c *Client) MeasureThrottle(nd *enode.Node) (*Throttle, error) {
+	var steps []RateStep
+	for i, st := range throttleSteps {
+		if i > 0 {
+			// Let the limiter of the node recover from the previous step.
+			select {
+			case <-time.After(stepRest):
+			case <-c.closed:
+				return nil, errClosed
+			}
+		}
+		step, err := c.probeAtRate(nd, st.rate, st.probes)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, *step)
+	}
+	return analyzeThrottle(steps), nil
+}
+
+// probeAtRate sends the probes at the given rate without waiting for the
+// responses in between. The probes waiting for their slots don't hold the
+// request slots of the client, see acquire.
+func (c *Client) probeAtRate(nd *enode.Node, rate float64, probes int) (*RateStep, error) {
+	interval := time.Duration(float64(time.Second) / rate)
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		sentAt   = make([]time.Time, probes)
+		answered = make([]bool, probes)
+		firstErr error
+	)
+	for i := 0; i < probes; i++ {
+		// Reserve the slots in order, so that the probes are sent in order.
+		slot := c.sched.reserveEvery(nd, interval, interval)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, elapsed, err := c.probe(nd, wire.RandomPacketSize, Timeout, func() time.Time { return slot })
+			lock.Lock()
+			defer lock.Unlock()
+			sentAt[i] = time.Now().Add(-elapsed)
+			if err == nil {
+				answered[i] = true
+			} else if err != ErrTimeout && firstErr == nil {
+				firstErr = err
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	step := &RateStep{Rate: rate, Sent: probes, Answered: answered}
+	for _, ok := range answered {
+		if ok {
+			step.Received++
+		}
+	}
+	step.LossRate = float64(probes-step.Received) / float64(probes)
+	times := append([]time.Time{}, sentAt...)
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	if d := times[len(times)-1].Sub(times[0]); d > 0 {
+		step.Rate = float64(probes-1) / d.Seconds()
+	}
+	return step, nil
+}
+
+// analyzeThrottle compares the loss at the faster rates with the loss at the
+// slowest rate and looks for the pattern of the responses.
+func analyzeThrottle(steps []RateStep) *Throttle {
+	t := &Throttle{Steps: steps, BaseLossRate: steps[0].LossRate, Pattern: PatternNone}
+	var fastest *RateStep
+	for i := range steps[1:] {
+		if steps[i+1].LossRate > t.BaseLossRate+throttleMargin {
+			fastest = &steps[i+1]
+		}
+	}
+	if fastest == nil {
+		return t
+	}
+	t.Throttled = true
+	// The responses which are lost by the network don't count against the
+	// limit of the node.
+	duration := float64(fastest.Sent) / fastest.Rate
+	t.ThrottleRate = float64(fastest.Received) / duration
+	if t.BaseLossRate < 1 {
+		t.ThrottleRate /= 1 - t.BaseLossRate
+	}
+	t.Pattern, t.BurstSize = responsePattern(fastest.Answered)
+	return t
+}
+
+// responsePattern classifies the sequence of the answered probes. It returns
+// the pattern and the number of responses before the first loss.
+func responsePattern(answered []bool) (string, int) {
+	burst := 0
+	for burst < len(answered) && answered[burst] {
+		burst++
+	}
+	// Count the runs of the answered probes and the runs of at least two lost
+	// probes, which are the silences.
+	var answeredRuns, silences int
+	for i := 0; i < len(answered); {
+		j := i
+		for j < len(answered) && answered[j] == answered[i] {
+			j++
+		}
+		if answered[i] {
+			answeredRuns++
+		} else if j-i >= 2 {
+			silences++
+		}
+		i = j
+	}
+	switch {
+	case burst > 0 && answeredRuns == 1:
+		return PatternBurst, burst
+	case answeredRuns >= 2 && silences >= 2:
+		return PatternWindow, burst
+	default:
+		return PatternRate, burst
+	}
+}
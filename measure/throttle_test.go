@@ -0,0 +1,65 @@
+package measure
+
+import "testing"
+
+func answers(pattern string) []bool {
+	answered := make([]bool, len(pattern))
+	for i, c := range pattern {
+		answered[i] = c == '1'
+	}
+	return answered
+}
+
+func TestResponsePattern(t *testing.T) {
+	tests := []struct {
+		answered string
+		pattern  string
+		burst    int
+	}{
+		{"1111000000", PatternBurst, 4},
+		{"1110001110001", PatternWindow, 3},
+		{"1011011010", PatternRate, 1},
+	}
+	for _, test := range tests {
+		pattern, burst := responsePattern(answers(test.answered))
+		if pattern != test.pattern || burst != test.burst {
+			t.Errorf("%s: got %s (burst %d), want %s (burst %d)", test.answered, pattern, burst, test.pattern, test.burst)
+		}
+	}
+}
+
+func TestAnalyzeThrottle(t *testing.T) {
+	step := func(rate float64, answered string) RateStep {
+		s := RateStep{Rate: rate, Sent: len(answered), Answered: answers(answered)}
+		for _, ok := range s.Answered {
+			if ok {
+				s.Received++
+			}
+		}
+		s.LossRate = float64(s.Sent-s.Received) / float64(s.Sent)
+		return s
+	}
+
+	// The loss doesn't depend on the rate.
+	lossy := analyzeThrottle([]RateStep{
+		step(2, "1010101010"),
+		step(10, "0101010101"),
+		step(50, "1100110011"),
+	})
+	if lossy.Throttled {
+		t.Errorf("a lossy node is reported as throttled: %v", lossy)
+	}
+
+	throttled := analyzeThrottle([]RateStep{
+		step(2, "1111111111"),
+		step(10, "1111111111"),
+		step(50, "1111100000"),
+	})
+	if !throttled.Throttled || throttled.Pattern != PatternBurst || throttled.BurstSize != 5 {
+		t.Errorf("wrong result for a throttled node: %v", throttled)
+	}
+	// Five responses in 0.2 seconds.
+	if throttled.ThrottleRate != 25 {
+		t.Errorf("wrong throttle rate: got %v, want 25", throttled.ThrottleRate)
+	}
+}
@@ -0,0 +1,116 @@
+package measure
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v4wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// The expiration of the discv4 packets we send.
+const v4Expiration = 20 * time.Second
+
+// Pong is a decoded discv4 PONG response.
+type Pong struct {
+	// The seq of the record of the responder, which is zero if the responder
+	// doesn't support EIP-868.
+	ENRSeq uint64
+	// Our endpoint which the responder sees.
+	To *net.UDPAddr
+	// The address which the response comes from.
+	From *net.UDPAddr
+}
+
+func (p *Pong) String() string {
+	return fmt.Sprintf("from=%v to=%v enr-seq=%d", p.From, p.To, p.ENRSeq)
+}
+
+// Ping sends a discv4 PING to the node and waits for the PONG. The client
+// must be created with Discv4.
+func (c *Client) Ping(nd *enode.Node) (*Pong, time.Duration, error) {
+	return c.PingTimeout(nd, Timeout)
+}
+
+// PingTimeout is like Ping, but it waits for the response only up to the
+// given duration.
+func (c *Client) PingTimeout(nd *enode.Node, d time.Duration) (*Pong, time.Duration, error) {
+	if c.protocol != Discv4 {
+		return nil, 0, fmt.Errorf("the client isn't created with %s", Discv4)
+	}
+	release, err := c.acquire(func() time.Time { return c.sched.reserve(nd) })
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	start := time.Now()
+	addr := &net.UDPAddr{IP: nd.IP(), Port: nd.UDP()}
+	local := c.usocket.LocalAddr().(*net.UDPAddr)
+	ping := &v4wire.Ping{
+		Version:    4,
+		From:       v4wire.NewEndpoint(local, 0),
+		To:         v4wire.NewEndpoint(addr, uint16(nd.TCP())),
+		Expiration: uint64(time.Now().Add(v4Expiration).Unix()),
+		ENRSeq:     c.ln.Node().Seq(),
+	}
+	packet, hash, err := v4wire.Encode(c.privateKey, ping)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+
+	c.lock.Lock()
+	// The channel is buffered, so that the read loop doesn't block when the
+	// response arrives right after the timeout.
+	ch := make(chan *Pong, 1)
+	c.activePingByHash[string(hash)] = ch
+	c.lock.Unlock()
+
+	if _, err := c.usocket.WriteToUDP(packet, addr); err != nil {
+		c.lock.Lock()
+		delete(c.activePingByHash, string(hash))
+		c.lock.Unlock()
+		return nil, time.Since(start), err
+	}
+
+	select {
+	case <-time.After(d):
+		c.lock.Lock()
+		delete(c.activePingByHash, string(hash))
+		c.lock.Unlock()
+		return nil, time.Since(start), ErrTimeout
+	case resp := <-ch:
+		return resp, time.Since(start), nil
+	}
+}
+
+// handleV4 handles a discv4 packet. Only the PONGs of our PINGs are used.
+// The PINGs which the nodes send to check our endpoint are ignored, because
+// we don't need them to answer our PINGs.
+func (c *Client) handleV4(content []byte, from *net.UDPAddr) {
+	packet, _, _, err := v4wire.Decode(content)
+	if err != nil {
+		// TODO: Log the error
+		return
+	}
+	pong, ok := packet.(*v4wire.Pong)
+	if !ok || v4wire.Expired(pong.Expiration) {
+		return
+	}
+
+	c.lock.Lock()
+	ch, ok := c.activePingByHash[string(pong.ReplyTok)]
+	if ok {
+		delete(c.activePingByHash, string(pong.ReplyTok))
+	}
+	c.lock.Unlock()
+	if !ok {
+		return
+	}
+	ch <- &Pong{
+		ENRSeq: pong.ENRSeq,
+		To:     &net.UDPAddr{IP: pong.To.IP, Port: int(pong.To.UDP)},
+		From:   from,
+	}
+}
@@ -0,0 +1,65 @@
+package measure
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// startV4 runs a discv4 node of geth on the loopback address.
+func startV4(t *testing.T) *discover.UDPv4 {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := enode.NewLocalNode(db, key)
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(socket.LocalAddr().(*net.UDPAddr).Port)
+	udp, err := discover.ListenV4(socket, ln, discover.Config{PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(udp.Close)
+	return udp
+}
+
+func TestPing(t *testing.T) {
+	nd := startV4(t).Self()
+	client, err := Listen(&Config{NodeInterval: -1, IPInterval: -1, Protocol: Discv4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pong, _, err := client.Ping(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pong.ENRSeq != nd.Seq() || pong.From.Port != nd.UDP() {
+		t.Errorf("wrong pong: %v", pong)
+	}
+	result, err := client.Run(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LossRate != 0 || result.Pong == nil || result.Whoareyou != nil {
+		t.Errorf("wrong result: %v", result)
+	}
+	if result.StaleEndpoint(nd) {
+		t.Errorf("the endpoint is stale: %v", result.From())
+	}
+	if _, _, err := client.Probe(nd); err != errNotDiscv5 {
+		t.Errorf("Probe returns %v, want %v", err, errNotDiscv5)
+	}
+}
@@ -0,0 +1,314 @@
+// Package pcap reads packets from pcap and pcapng files without libpcap.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Link types.
+const (
+	LinkTypeNull      = 0
+	LinkTypeEthernet  = 1
+	LinkTypeRaw       = 101
+	LinkTypeLinuxSLL  = 113
+	LinkTypeIPv4      = 228
+	LinkTypeIPv6      = 229
+	LinkTypeLinuxSLL2 = 276
+)
+
+// Magic numbers.
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	// The block type of the pcapng section header block.
+	blockSectionHeader = 0x0a0d0d0a
+	magicByteOrder     = 0x1a2b3c4d
+)
+
+// The pcapng block types.
+const (
+	blockInterface      = 0x00000001
+	blockSimplePacket   = 0x00000003
+	blockEnhancedPacket = 0x00000006
+)
+
+// The pcapng option code of the timestamp resolution of an interface.
+const optionTsresol = 9
+
+// The maximum size of a block or a packet we are willing to read.
+const maxBlockSize = 16 * 1024 * 1024
+
+var (
+	errUnknownFormat = errors.New("unknown file format")
+	errBlockTooLarge = errors.New("block too large")
+	errBadBlock      = errors.New("malformed block")
+	errNoInterface   = errors.New("packet refers to an unknown interface")
+)
+
+// Packet is a packet read from the file.
+type Packet struct {
+	Time     time.Time
+	LinkType int
+	// The captured bytes, which may be shorter than the packet on the wire.
+	Data []byte
+}
+
+type iface struct {
+	linkType int
+	snapLen  uint32
+	// The number of timestamp units in a second.
+	units uint64
+}
+
+// Reader reads packets from a pcap or pcapng file.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// Used only for pcap.
+	linkType int
+	nano     bool
+
+	// Used only for pcapng.
+	ifaces []iface
+}
+
+// NewReader creates a reader and reads the file header. The format is
+// detected from the magic number.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	magic, err := rd.r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(magic) == blockSectionHeader:
+		rd.ng = true
+		// The byte order is read from the section header block.
+		return rd, nil
+	case binary.LittleEndian.Uint32(magic) == magicMicroseconds:
+		rd.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == magicMicroseconds:
+		rd.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(magic) == magicNanoseconds:
+		rd.order, rd.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(magic) == magicNanoseconds:
+		rd.order, rd.nano = binary.BigEndian, true
+	default:
+		return nil, errUnknownFormat
+	}
+
+	var head [24]byte
+	if _, err := io.ReadFull(rd.r, head[:]); err != nil {
+		return nil, err
+	}
+	rd.linkType = int(rd.order.Uint32(head[20:24]) & 0xffff)
+	return rd, nil
+}
+
+// Next returns the next packet. It returns io.EOF at the end of the file.
+func (rd *Reader) Next() (*Packet, error) {
+	if rd.ng {
+		return rd.nextBlock()
+	}
+	var head [16]byte
+	if _, err := io.ReadFull(rd.r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errBadBlock
+		}
+		return nil, err
+	}
+	sec := int64(rd.order.Uint32(head[0:4]))
+	frac := int64(rd.order.Uint32(head[4:8]))
+	inclLen := rd.order.Uint32(head[8:12])
+	if inclLen > maxBlockSize {
+		return nil, errBlockTooLarge
+	}
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(rd.r, data); err != nil {
+		return nil, errBadBlock
+	}
+	if !rd.nano {
+		frac *= 1000
+	}
+	return &Packet{Time: time.Unix(sec, frac).UTC(), LinkType: rd.linkType, Data: data}, nil
+}
+
+// nextBlock reads pcapng blocks until it finds a packet.
+func (rd *Reader) nextBlock() (*Packet, error) {
+	for {
+		var head [8]byte
+		if _, err := io.ReadFull(rd.r, head[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, errBadBlock
+			}
+			return nil, err
+		}
+		// The byte order isn't known yet in the section header block, so
+		// the body is read first.
+		typ := binary.LittleEndian.Uint32(head[0:4])
+		if typ == blockSectionHeader {
+			if err := rd.readSectionHeader(head[4:8]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if rd.order == nil {
+			return nil, errBadBlock
+		}
+		typ = rd.order.Uint32(head[0:4])
+		length := rd.order.Uint32(head[4:8])
+		if length < 12 || length%4 != 0 {
+			return nil, errBadBlock
+		}
+		if length > maxBlockSize {
+			return nil, errBlockTooLarge
+		}
+		block := make([]byte, length-8)
+		if _, err := io.ReadFull(rd.r, block); err != nil {
+			return nil, errBadBlock
+		}
+		// Remove the trailing block length.
+		body := block[:len(block)-4]
+
+		switch typ {
+		case blockInterface:
+			if err := rd.readInterface(body); err != nil {
+				return nil, err
+			}
+		case blockEnhancedPacket:
+			return rd.readEnhancedPacket(body)
+		case blockSimplePacket:
+			return rd.readSimplePacket(body)
+		}
+		// Skip the other blocks.
+	}
+}
+
+func (rd *Reader) readSectionHeader(rawLength []byte) error {
+	var bom [4]byte
+	if _, err := io.ReadFull(rd.r, bom[:]); err != nil {
+		return errBadBlock
+	}
+	switch {
+	case binary.LittleEndian.Uint32(bom[:]) == magicByteOrder:
+		rd.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(bom[:]) == magicByteOrder:
+		rd.order = binary.BigEndian
+	default:
+		return errBadBlock
+	}
+	length := rd.order.Uint32(rawLength)
+	if length < 16 || length%4 != 0 {
+		return errBadBlock
+	}
+	if length > maxBlockSize {
+		return errBlockTooLarge
+	}
+	// Skip the rest of the block. The interfaces belong to the section.
+	if _, err := rd.r.Discard(int(length) - 12); err != nil {
+		return errBadBlock
+	}
+	rd.ifaces = nil
+	return nil
+}
+
+func (rd *Reader) readInterface(body []byte) error {
+	if len(body) < 8 {
+		return errBadBlock
+	}
+	ifc := iface{
+		linkType: int(rd.order.Uint16(body[0:2])),
+		snapLen:  rd.order.Uint32(body[4:8]),
+		units:    1000000,
+	}
+	// Look for the timestamp resolution in the options.
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := rd.order.Uint16(opts[0:2])
+		olen := int(rd.order.Uint16(opts[2:4]))
+		if 4+olen > len(opts) {
+			return errBadBlock
+		}
+		if code == optionTsresol && olen >= 1 {
+			v := opts[4]
+			exp := int(v & 0x7f)
+			if v&0x80 == 0 {
+				if exp > 19 {
+					return errBadBlock
+				}
+				ifc.units = 1
+				for i := 0; i < exp; i++ {
+					ifc.units *= 10
+				}
+			} else {
+				if exp > 63 {
+					return errBadBlock
+				}
+				ifc.units = 1 << exp
+			}
+		}
+		if code == 0 {
+			break
+		}
+		// Options are padded to 32 bits.
+		next := 4 + (olen+3)/4*4
+		if next > len(opts) {
+			break
+		}
+		opts = opts[next:]
+	}
+	rd.ifaces = append(rd.ifaces, ifc)
+	return nil
+}
+
+func (rd *Reader) readEnhancedPacket(body []byte) (*Packet, error) {
+	if len(body) < 20 {
+		return nil, errBadBlock
+	}
+	id := rd.order.Uint32(body[0:4])
+	if int(id) >= len(rd.ifaces) {
+		return nil, errNoInterface
+	}
+	ifc := rd.ifaces[id]
+	ts := uint64(rd.order.Uint32(body[4:8]))<<32 | uint64(rd.order.Uint32(body[8:12]))
+	capLen := rd.order.Uint32(body[12:16])
+	if uint64(capLen) > uint64(len(body)-20) {
+		return nil, errBadBlock
+	}
+	sec := ts / ifc.units
+	// The multiplication may overflow 64 bits for fine resolutions.
+	hi, lo := bits.Mul64(ts%ifc.units, uint64(time.Second))
+	nsec, _ := bits.Div64(hi, lo, ifc.units)
+	return &Packet{
+		Time:     time.Unix(int64(sec), int64(nsec)).UTC(),
+		LinkType: ifc.linkType,
+		Data:     body[20 : 20+capLen],
+	}, nil
+}
+
+func (rd *Reader) readSimplePacket(body []byte) (*Packet, error) {
+	if len(rd.ifaces) == 0 {
+		return nil, errNoInterface
+	}
+	if len(body) < 4 {
+		return nil, errBadBlock
+	}
+	ifc := rd.ifaces[0]
+	origLen := rd.order.Uint32(body[0:4])
+	capLen := uint32(len(body) - 4)
+	if origLen < capLen {
+		capLen = origLen
+	}
+	if ifc.snapLen != 0 && ifc.snapLen < capLen {
+		capLen = ifc.snapLen
+	}
+	// Simple packet blocks don't have timestamps.
+	return &Packet{LinkType: ifc.linkType, Data: body[4 : 4+capLen]}, nil
+}
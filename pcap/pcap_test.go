@@ -0,0 +1,119 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	testSrc     = &net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 9000}
+	testDst     = &net.UDPAddr{IP: net.IP{10, 0, 0, 2}, Port: 30303}
+	testPayload = []byte("discv5 payload")
+	testTime    = time.Unix(1656928351, 123456000).UTC()
+)
+
+// ethernetFrame builds an Ethernet frame containing a UDP datagram.
+func ethernetFrame() []byte {
+	udp := make([]byte, 8, 8+len(testPayload))
+	binary.BigEndian.PutUint16(udp[0:2], uint16(testSrc.Port))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(testDst.Port))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(testPayload)))
+	udp = append(udp, testPayload...)
+
+	ip := make([]byte, 20, 20+len(udp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(udp)))
+	ip[8] = 64
+	ip[9] = protocolUDP
+	copy(ip[12:16], testSrc.IP.To4())
+	copy(ip[16:20], testDst.IP.To4())
+	ip = append(ip, udp...)
+
+	eth := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(eth[12:14], etherTypeIPv4)
+	return append(eth, ip...)
+}
+
+func pcapFile(order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	frame := ethernetFrame()
+	binary.Write(&buf, order, []uint32{magicMicroseconds, 0x00040002, 0, 0, 65535, LinkTypeEthernet})
+	binary.Write(&buf, order, []uint32{
+		uint32(testTime.Unix()), uint32(testTime.Nanosecond() / 1000),
+		uint32(len(frame)), uint32(len(frame)),
+	})
+	buf.Write(frame)
+	return buf.Bytes()
+}
+
+func pcapngFile(order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	// Section header block.
+	binary.Write(&buf, order, []uint32{blockSectionHeader, 28, magicByteOrder, 0x00000001})
+	binary.Write(&buf, order, int64(-1))
+	binary.Write(&buf, order, uint32(28))
+	// Interface description block with nanosecond resolution.
+	binary.Write(&buf, order, []uint32{blockInterface, 32})
+	binary.Write(&buf, order, []uint16{LinkTypeEthernet, 0})
+	binary.Write(&buf, order, uint32(0))
+	binary.Write(&buf, order, []uint16{optionTsresol, 1})
+	buf.Write([]byte{9, 0, 0, 0})
+	binary.Write(&buf, order, []uint32{0, 32})
+	// Enhanced packet block.
+	frame := ethernetFrame()
+	padded := (len(frame) + 3) / 4 * 4
+	ts := uint64(testTime.UnixNano())
+	binary.Write(&buf, order, []uint32{
+		blockEnhancedPacket, uint32(32 + padded), 0,
+		uint32(ts >> 32), uint32(ts), uint32(len(frame)), uint32(len(frame)),
+	})
+	buf.Write(frame)
+	buf.Write(make([]byte, padded-len(frame)))
+	binary.Write(&buf, order, uint32(32+padded))
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	files := map[string][]byte{
+		"pcap-le":   pcapFile(binary.LittleEndian),
+		"pcap-be":   pcapFile(binary.BigEndian),
+		"pcapng-le": pcapngFile(binary.LittleEndian),
+		"pcapng-be": pcapngFile(binary.BigEndian),
+	}
+	for name, file := range files {
+		rd, err := NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: NewReader returns an error: %v", name, err)
+		}
+		p, err := rd.Next()
+		if err != nil {
+			t.Fatalf("%s: Next returns an error: %v", name, err)
+		}
+		if !p.Time.Equal(testTime) {
+			t.Errorf("%s: wrong time: got %v, want %v", name, p.Time, testTime)
+		}
+		udp, ok := p.DecodeUDP()
+		if !ok {
+			t.Fatalf("%s: no UDP datagram is found", name)
+		}
+		if udp.Src.String() != testSrc.String() || udp.Dst.String() != testDst.String() {
+			t.Errorf("%s: wrong addresses: got %v -> %v", name, udp.Src, udp.Dst)
+		}
+		if !bytes.Equal(udp.Payload, testPayload) {
+			t.Errorf("%s: wrong payload: got %q", name, udp.Payload)
+		}
+		if _, err := rd.Next(); err != io.EOF {
+			t.Errorf("%s: Next returns %v at the end of the file, want io.EOF", name, err)
+		}
+	}
+}
+
+func TestReaderUnknownFormat(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a pcap file"))); err != errUnknownFormat {
+		t.Errorf("NewReader returns %v, want %v", err, errUnknownFormat)
+	}
+}
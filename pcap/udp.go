@@ -0,0 +1,128 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// EtherTypes and IP protocol numbers.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	protocolUDP   = 17
+)
+
+// UDP is a UDP datagram found in a packet.
+type UDP struct {
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Payload []byte
+}
+
+// DecodeUDP decodes the link layer and the IP layer of the packet and
+// returns the UDP datagram in it. It returns false if the packet doesn't
+// contain a complete UDP datagram, e.g. it's a fragment or it's truncated.
+func (p *Packet) DecodeUDP() (*UDP, bool) {
+	data := p.Data
+	var etherType uint16
+	switch p.LinkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == etherTypeVLAN {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return nil, false
+		}
+		// The address family is in the byte order of the capturing host.
+		family := binary.LittleEndian.Uint32(data[0:4])
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(data[0:4])
+		}
+		switch family {
+		case 2:
+			etherType = etherTypeIPv4
+		case 10, 24, 28, 30:
+			etherType = etherTypeIPv6
+		}
+		data = data[4:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		if len(data) == 0 {
+			return nil, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	}
+
+	var srcIP, dstIP net.IP
+	switch etherType {
+	case etherTypeIPv4:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return nil, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		flagsOffset := binary.BigEndian.Uint16(data[6:8])
+		// Skip fragments: more fragments flag or non-zero offset.
+		if flagsOffset&0x3fff != 0 {
+			return nil, false
+		}
+		if data[9] != protocolUDP || ihl < 20 || total < ihl || len(data) < total {
+			return nil, false
+		}
+		srcIP, dstIP = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:total]
+	case etherTypeIPv6:
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return nil, false
+		}
+		// Extension headers aren't supported.
+		payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+		if data[6] != protocolUDP || len(data) < 40+payloadLen {
+			return nil, false
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40 : 40+payloadLen]
+	default:
+		return nil, false
+	}
+
+	if len(data) < 8 {
+		return nil, false
+	}
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	if length < 8 || len(data) < length {
+		return nil, false
+	}
+	return &UDP{
+		Src:     &net.UDPAddr{IP: srcIP, Port: int(binary.BigEndian.Uint16(data[0:2]))},
+		Dst:     &net.UDPAddr{IP: dstIP, Port: int(binary.BigEndian.Uint16(data[2:4]))},
+		Payload: data[8:length],
+	}, true
+}
@@ -0,0 +1,127 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASNTable maps the IP addresses to the AS numbers.
+type ASNTable struct {
+	// The ranges sorted by the first address.
+	ranges []asnRange
+}
+
+type asnRange struct {
+	first, last net.IP
+	asn         uint32
+}
+
+// ReadASNFile reads the table of AS numbers from the file. See ReadASN for the
+// format.
+func ReadASNFile(file string) (*ASNTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadASN(f)
+}
+
+// ReadASN reads the table of AS numbers. Each line is either a CIDR range
+// followed by the AS number, e.g. "3.0.0.0/15 16509", or the first and the
+// last addresses of a range followed by the AS number and any other columns,
+// as in the ip2asn files of iptoasn.com. The AS number may be prefixed with
+// "AS". Empty lines and lines starting with # are skipped. The ranges
+// shouldn't overlap.
+func ReadASN(r io.Reader) (*ASNTable, error) {
+	t := &ASNTable{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rg, err := parseASNLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		t.ranges = append(t.ranges, rg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(t.ranges, func(i, j int) bool {
+		return bytes.Compare(t.ranges[i].first, t.ranges[j].first) < 0
+	})
+	return t, nil
+}
+
+func parseASNLine(line string) (asnRange, error) {
+	cols := strings.Fields(line)
+	var (
+		rg  asnRange
+		asn string
+	)
+	switch {
+	case len(cols) == 2 && strings.Contains(cols[0], "/"):
+		_, ipnet, err := net.ParseCIDR(cols[0])
+		if err != nil {
+			return rg, fmt.Errorf("invalid ip range %q", cols[0])
+		}
+		rg.first = ipnet.IP.To16()
+		rg.last = make(net.IP, net.IPv6len)
+		copy(rg.last, rg.first)
+		// The mask of an IPv4 range is 4 bytes long, so it applies to the
+		// last 4 bytes of the 16-byte address.
+		off := net.IPv6len - len(ipnet.Mask)
+		for i, m := range ipnet.Mask {
+			rg.last[off+i] |= ^m
+		}
+		asn = cols[1]
+	case len(cols) >= 3:
+		rg.first, rg.last = net.ParseIP(cols[0]).To16(), net.ParseIP(cols[1]).To16()
+		if rg.first == nil || rg.last == nil {
+			return rg, fmt.Errorf("invalid ip range %s-%s", cols[0], cols[1])
+		}
+		asn = cols[2]
+	default:
+		return rg, fmt.Errorf("invalid line %q", line)
+	}
+	v, err := strconv.ParseUint(trimAS(asn), 10, 32)
+	if err != nil {
+		return rg, fmt.Errorf("invalid AS number %q", asn)
+	}
+	rg.asn = uint32(v)
+	return rg, nil
+}
+
+// Lookup returns the AS number of the IP address, or 0 if it isn't in the
+// table.
+func (t *ASNTable) Lookup(ip net.IP) uint32 {
+	if ip = ip.To16(); ip == nil {
+		return 0
+	}
+	// Find the last range which starts at or before the address.
+	i := sort.Search(len(t.ranges), func(i int) bool {
+		return bytes.Compare(t.ranges[i].first, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, t.ranges[i].last) > 0 {
+		return 0
+	}
+	return t.ranges[i].asn
+}
+
+// trimAS removes the "AS" prefix of an AS number.
+func trimAS(s string) string {
+	if len(s) > 2 && strings.EqualFold(s[:2], "as") {
+		return s[2:]
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package query
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestASN(t *testing.T) {
+	table, err := ReadASN(strings.NewReader(`# cidr asn
+3.0.0.0/15 16509
+2600:1f00::/24 AS16509
+# first last asn country description
+34.64.0.0	34.127.255.255	396982	US	GOOGLE-CLOUD-PLATFORM
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want uint32
+	}{
+		{"3.0.0.1", 16509},
+		{"3.1.255.255", 16509},
+		{"3.2.0.0", 0},
+		{"2600:1f00::1", 16509},
+		{"34.100.0.1", 396982},
+		{"34.128.0.0", 0},
+		{"1.1.1.1", 0},
+	}
+	for _, test := range tests {
+		if got := table.Lookup(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("%s: got AS%d, want AS%d", test.ip, got, test.want)
+		}
+	}
+
+	for _, line := range []string{"3.0.0.0/99 16509", "3.0.0.0/15 ASX", "3.0.0.0"} {
+		if _, err := ReadASN(strings.NewReader(line)); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
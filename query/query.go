@@ -0,0 +1,390 @@
+// Package query filters and sorts the nodes in node set files.
+//
+// A filter is a list of conditions joined by && and ||, where && binds
+// tighter than ||. Each condition compares a field of the node with a value,
+// e.g. "fork=b5303f2a && loss<0.05 || client=lighthouse". The fields are
+// listed in Fields.
+package query
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/record"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+// Entry is a node object in the node set file with its ENR parsed.
+type Entry struct {
+	*snapshot.Node
+	Record *enode.Node
+	// The AS number of the IP address in the record, or 0 if it's unknown.
+	ASN uint32
+}
+
+// Entries parses the ENRs of the nodes.
+func Entries(nodes []snapshot.Node) ([]*Entry, error) {
+	entries := make([]*Entry, 0, len(nodes))
+	for i := range nodes {
+		nd, err := nodes[i].Node()
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %q: %v", nodes[i].NodeUrl, err)
+		}
+		entries = append(entries, &Entry{Node: &nodes[i], Record: nd})
+	}
+	return entries, nil
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindNumber
+	kindDuration
+	kindTime
+	kindIP
+	kindBool
+	// The key field is special. Its condition tells whether the record has the
+	// entry, so it doesn't have a value.
+	kindKey
+)
+
+type field struct {
+	kind kind
+	get  func(e *Entry) interface{}
+}
+
+var fields = map[string]field{
+	"id":  {kindString, func(e *Entry) interface{} { return e.Record.ID().String() }},
+	"seq": {kindNumber, func(e *Entry) interface{} { return float64(e.Record.Seq()) }},
+	"ip":  {kindIP, func(e *Entry) interface{} { return e.Record.IP() }},
+	"udp": {kindNumber, func(e *Entry) interface{} { return float64(e.Record.UDP()) }},
+	"tcp": {kindNumber, func(e *Entry) interface{} { return float64(e.Record.TCP()) }},
+	"asn": {kindNumber, func(e *Entry) interface{} { return float64(e.ASN) }},
+	"fork": {kindString, func(e *Entry) interface{} {
+		return record.ForkDigest(e.Record.Record())
+	}},
+	"client": {kindString, func(e *Entry) interface{} {
+		if client := record.Client(e.Record.Record()); len(client) > 0 {
+			return strings.ToLower(client[0])
+		}
+		return ""
+	}},
+	"key":     {kindKey, nil},
+	"rtt":     {kindDuration, func(e *Entry) interface{} { return e.Result.Rtt }},
+	"loss":    {kindNumber, func(e *Entry) interface{} { return e.Result.LossRate }},
+	"stale":   {kindBool, func(e *Entry) interface{} { return e.StaleEndpoint != "" }},
+	"vantage": {kindString, func(e *Entry) interface{} { return e.Vantage }},
+	"protocol": {kindString, func(e *Entry) interface{} {
+		if e.Protocol == "" {
+			return measure.Discv5
+		}
+		return e.Protocol
+	}},
+	"refreshed": {kindTime, func(e *Entry) interface{} { return e.RefreshedAt }},
+	"updated":   {kindTime, func(e *Entry) interface{} { return e.UpdatedAt }},
+}
+
+// Fields are the names of the fields which can be used in filters, sorting
+// and Entry.Format, except "key" which can only be used in filters.
+var Fields = []string{
+	"id", "seq", "ip", "udp", "tcp", "asn", "fork", "client", "key",
+	"rtt", "loss", "stale", "vantage", "protocol", "refreshed", "updated",
+}
+
+// The operators ordered so that the longer ones are tried first.
+var operators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// Filter is a parsed filter.
+type Filter struct {
+	// The conditions in the disjunctive normal form.
+	any [][]condition
+	// The fields used in the conditions.
+	fields map[string]bool
+}
+
+type condition func(e *Entry) bool
+
+// Parse parses the filter. The empty filter matches every node.
+func Parse(expr string) (*Filter, error) {
+	f := &Filter{fields: make(map[string]bool)}
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+	for _, conj := range strings.Split(expr, "||") {
+		var all []condition
+		for _, s := range strings.Split(conj, "&&") {
+			name, c, err := parseCondition(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			f.fields[name] = true
+			all = append(all, c)
+		}
+		f.any = append(f.any, all)
+	}
+	return f, nil
+}
+
+// Uses reports whether the field is used in the filter.
+func (f *Filter) Uses(name string) bool {
+	return f.fields[name]
+}
+
+// Match reports whether the node matches the filter.
+func (f *Filter) Match(e *Entry) bool {
+	if len(f.any) == 0 {
+		return true
+	}
+	for _, all := range f.any {
+		matched := true
+		for _, c := range all {
+			if !c(e) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCondition parses a condition and returns the name of its field. The
+// condition is split at the leftmost operator, so the value may contain the
+// operator characters.
+func parseCondition(s string) (string, condition, error) {
+	var name, op, value string
+	if i := strings.IndexAny(s, "!<>="); i >= 0 {
+		for _, o := range operators {
+			if strings.HasPrefix(s[i:], o) {
+				name, op, value = strings.TrimSpace(s[:i]), o, strings.TrimSpace(s[i+len(o):])
+				break
+			}
+		}
+	}
+	if op == "" {
+		return "", nil, fmt.Errorf("invalid condition %q", s)
+	}
+	c, err := newCondition(name, op, value)
+	return name, c, err
+}
+
+func newCondition(name, op, value string) (condition, error) {
+	f, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+	ordered := op != "=" && op != "!="
+	negate := op == "!="
+
+	switch f.kind {
+	case kindKey:
+		if ordered {
+			return nil, fmt.Errorf("invalid operator %s for the field %s", op, name)
+		}
+		return func(e *Entry) bool {
+			return record.HasKey(e.Record.Record(), value) != negate
+		}, nil
+	case kindIP:
+		if ordered {
+			return nil, fmt.Errorf("invalid operator %s for the field %s", op, name)
+		}
+		// The value is either an IP address or a CIDR range.
+		if !strings.Contains(value, "/") {
+			if strings.Contains(value, ":") {
+				value += "/128"
+			} else {
+				value += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip range %q", value)
+		}
+		return func(e *Entry) bool {
+			ip := f.get(e).(net.IP)
+			return (ip != nil && ipnet.Contains(ip)) != negate
+		}, nil
+	case kindBool:
+		if ordered {
+			return nil, fmt.Errorf("invalid operator %s for the field %s", op, name)
+		}
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", value)
+		}
+		return func(e *Entry) bool {
+			return (f.get(e).(bool) == v) != negate
+		}, nil
+	case kindString:
+		if ordered {
+			return nil, fmt.Errorf("invalid operator %s for the field %s", op, name)
+		}
+		value = strings.ToLower(value)
+		if name == "fork" {
+			value = strings.TrimPrefix(value, "0x")
+		}
+		if name == "id" {
+			// The node ID can be given as a prefix.
+			return func(e *Entry) bool {
+				return strings.HasPrefix(f.get(e).(string), value) != negate
+			}, nil
+		}
+		return func(e *Entry) bool {
+			return (f.get(e).(string) == value) != negate
+		}, nil
+	}
+
+	if name == "asn" {
+		value = trimAS(value)
+	}
+	v, err := parseValue(f.kind, value)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *Entry) bool {
+		return compareOp(compare(f.get(e), v), op)
+	}, nil
+}
+
+// parseValue parses the value of the number, duration and time fields. The
+// value of a time field is either in RFC 3339 or a duration relative to now,
+// e.g. "-24h" means 24 hours ago.
+func parseValue(k kind, s string) (interface{}, error) {
+	switch k {
+	case kindNumber:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return v, nil
+	case kindDuration:
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", s)
+		}
+		return v, nil
+	case kindTime:
+		if d, err := time.ParseDuration(s); err == nil {
+			return time.Now().Add(d), nil
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", s)
+		}
+		return v, nil
+	}
+	panic("unreachable")
+}
+
+func compareOp(c int, op string) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// compare compares two values of the same field.
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Duration:
+		b := b.(time.Duration)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case net.IP:
+		return strings.Compare(string(a.To16()), string(b.(net.IP).To16()))
+	}
+	panic("unreachable")
+}
+
+// Sort sorts the nodes by the field in the ascending order, or the descending
+// order if the field is prefixed with "-", e.g. "-rtt".
+func Sort(entries []*Entry, by string) error {
+	desc := strings.HasPrefix(by, "-")
+	name := strings.TrimPrefix(by, "-")
+	f, ok := fields[name]
+	if !ok || f.kind == kindKey {
+		return fmt.Errorf("cannot sort by %q", name)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		c := compare(f.get(entries[i]), f.get(entries[j]))
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+// Format returns the value of the field as a string.
+func (e *Entry) Format(name string) string {
+	f, ok := fields[name]
+	if !ok || f.kind == kindKey {
+		return ""
+	}
+	switch v := f.get(e).(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case net.IP:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ppopth/discv5-tools/measure"
+	"github.com/ppopth/discv5-tools/snapshot"
+)
+
+func testEntry(t *testing.T, ip net.IP, eth2 []byte, result measure.Result) *Entry {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r enr.Record
+	r.Set(enr.IP(ip))
+	r.Set(enr.UDP(9000))
+	if eth2 != nil {
+		r.Set(enr.WithEntry("eth2", eth2))
+	}
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Entry{
+		Node:   &snapshot.Node{NodeUrl: nd.String(), Result: result, UpdatedAt: time.Now()},
+		Record: nd,
+	}
+}
+
+func TestFilter(t *testing.T) {
+	eth2 := append([]byte{0xb5, 0x30, 0x3f, 0x2a}, make([]byte, 12)...)
+	fast := testEntry(t, net.IP{10, 0, 0, 1}, eth2, measure.Result{Rtt: 50 * time.Millisecond})
+	lossy := testEntry(t, net.IP{10, 0, 0, 2}, eth2, measure.Result{Rtt: 50 * time.Millisecond, LossRate: 0.5})
+	other := testEntry(t, net.IP{192, 168, 0, 1}, nil, measure.Result{Rtt: 300 * time.Millisecond})
+	fast.ASN = 16509
+	fast.Vantage = "a<b"
+	entries := []*Entry{fast, lossy, other}
+
+	tests := []struct {
+		expr string
+		want []*Entry
+	}{
+		{"", entries},
+		{"fork=b5303f2a && loss<0.05", []*Entry{fast}},
+		{"fork=0xB5303F2A", []*Entry{fast, lossy}},
+		{"asn=AS16509", []*Entry{fast}},
+		{"asn=0", []*Entry{lossy, other}},
+		{"vantage=a<b", []*Entry{fast}},
+		{"vantage!=a<b", []*Entry{lossy, other}},
+		{"key=eth2", []*Entry{fast, lossy}},
+		{"key!=eth2 || loss>=0.5", []*Entry{lossy, other}},
+		{"ip=10.0.0.0/8 && rtt<=50ms", []*Entry{fast, lossy}},
+		{"ip!=10.0.0.2", []*Entry{fast, other}},
+		{"id=" + other.Record.ID().String()[:8], []*Entry{other}},
+		{"updated>-1h && stale=false", entries},
+	}
+	for _, test := range tests {
+		f, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		var got []*Entry
+		for _, e := range entries {
+			if f.Match(e) {
+				got = append(got, e)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %d nodes, want %d", test.expr, len(got), len(test.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: wrong node at %d", test.expr, i)
+			}
+		}
+	}
+
+	f, err := Parse("loss<0.05 || asn=16509")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Uses("asn") || !f.Uses("loss") || f.Uses("rtt") {
+		t.Errorf("wrong fields used by the filter")
+	}
+
+	for _, expr := range []string{"rtt", "rtt!", "foo=1", "fork<1", "loss<abc", "ip=10.0.0.0/99"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	a := testEntry(t, net.IP{10, 0, 0, 1}, nil, measure.Result{Rtt: 300 * time.Millisecond})
+	b := testEntry(t, net.IP{10, 0, 0, 2}, nil, measure.Result{Rtt: 100 * time.Millisecond})
+	c := testEntry(t, net.IP{10, 0, 0, 3}, nil, measure.Result{Rtt: 200 * time.Millisecond})
+
+	entries := []*Entry{a, b, c}
+	if err := Sort(entries, "rtt"); err != nil {
+		t.Fatal(err)
+	}
+	if entries[0] != b || entries[1] != c || entries[2] != a {
+		t.Errorf("wrong ascending order")
+	}
+	if err := Sort(entries, "-ip"); err != nil {
+		t.Fatal(err)
+	}
+	if entries[0] != c || entries[1] != b || entries[2] != a {
+		t.Errorf("wrong descending order")
+	}
+	if err := Sort(entries, "key"); err == nil {
+		t.Errorf("sorting by key has no error")
+	}
+}
@@ -0,0 +1,85 @@
+// Package record decodes the common entries of node records.
+package record
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+var errNoEntry = errors.New("the record doesn't have the entry")
+
+// The size of the SSZ encoding of ENRForkID: a 4-byte fork digest, a 4-byte
+// next fork version and an 8-byte next fork epoch.
+const sizeofForkID = 16
+
+// ForkID is the value of the "eth2" entry of consensus layer nodes.
+type ForkID struct {
+	ForkDigest      [4]byte
+	NextForkVersion [4]byte
+	NextForkEpoch   uint64
+}
+
+// Eth2 decodes the "eth2" entry of the record.
+func Eth2(r *enr.Record) (*ForkID, error) {
+	var raw []byte
+	if err := r.Load(enr.WithEntry("eth2", &raw)); err != nil {
+		if enr.IsNotFound(err) {
+			return nil, errNoEntry
+		}
+		return nil, err
+	}
+	if len(raw) < sizeofForkID {
+		return nil, fmt.Errorf("invalid eth2 entry size %d", len(raw))
+	}
+	var id ForkID
+	copy(id.ForkDigest[:], raw[0:4])
+	copy(id.NextForkVersion[:], raw[4:8])
+	id.NextForkEpoch = binary.LittleEndian.Uint64(raw[8:16])
+	return &id, nil
+}
+
+// ForkDigest returns the fork digest in the "eth2" entry as a hex string, or
+// the empty string if the record doesn't have a valid one.
+func ForkDigest(r *enr.Record) string {
+	id, err := Eth2(r)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", id.ForkDigest)
+}
+
+// Keys returns the keys of the record.
+func Keys(r *enr.Record) []string {
+	var keys []string
+	// The elements are the seq followed by the key-value pairs.
+	elems := r.AppendElements(nil)
+	for i := 1; i+1 < len(elems); i += 2 {
+		if k, ok := elems[i].(string); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// HasKey reports whether the record has the entry.
+func HasKey(r *enr.Record, key string) bool {
+	for _, k := range Keys(r) {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Client returns the value of the "client" entry, which is the client name
+// usually followed by the version, or nil if the record doesn't have one.
+func Client(r *enr.Record) []string {
+	var client []string
+	if err := r.Load(enr.WithEntry("client", &client)); err != nil {
+		return nil
+	}
+	return client
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// The number of closest nodes kept during a lookup.
+	bucketSize = 16
+	// The number of concurrent queries during a lookup.
+	alpha = 3
+	// The number of distances asked in one query.
+	lookupRequestLimit = 3
+)
+
+// Query is a FINDNODE query done during a lookup.
+type Query struct {
+	// The node being queried.
+	Node *enode.Node
+	// The distances asked in the query.
+	Distances []uint
+	// The nodes returned by the queried node.
+	Found []*enode.Node
+	// The time it takes to get the first response.
+	Latency time.Duration
+	// The time since the lookup started when the query finished.
+	Elapsed time.Duration
+	Err     error
+	// The log distance between the target and the closest node found so far,
+	// including the nodes found in this query.
+	Closest int
+}
+
+// Lookup performs an iterative lookup for the target starting from the seed
+// nodes and returns the closest nodes found. The trace function, if it's not
+// nil, is called after every query in the same routine as Lookup.
+func (c *Client) Lookup(target enode.ID, seeds []*enode.Node, trace func(*Query)) []*enode.Node {
+	var (
+		start    = time.Now()
+		result   []*enode.Node
+		seen     = make(map[enode.ID]bool)
+		asked    = make(map[enode.ID]bool)
+		pending  = 0
+		replyCh  = make(chan *Query, alpha)
+		closest  = 257
+		addNodes = func(nodes []*enode.Node) {
+			for _, n := range nodes {
+				if seen[n.ID()] || n.ID() == c.ln.ID() {
+					continue
+				}
+				seen[n.ID()] = true
+				result = append(result, n)
+				if d := enode.LogDist(target, n.ID()); d < closest {
+					closest = d
+				}
+			}
+			sort.Slice(result, func(i, j int) bool {
+				return enode.DistCmp(target, result[i].ID(), result[j].ID()) < 0
+			})
+			if len(result) > bucketSize {
+				result = result[:bucketSize]
+			}
+		}
+	)
+	addNodes(seeds)
+
+	for {
+		// Ask the closest nodes which haven't been asked yet.
+		for i := 0; i < len(result) && pending < alpha; i++ {
+			n := result[i]
+			if asked[n.ID()] {
+				continue
+			}
+			asked[n.ID()] = true
+			pending++
+			go func() {
+				q := &Query{Node: n, Distances: lookupDistances(target, n.ID())}
+				q.Found, q.Latency, q.Err = c.Findnode(n, q.Distances)
+				replyCh <- q
+			}()
+		}
+		if pending == 0 {
+			return result
+		}
+		q := <-replyCh
+		pending--
+		addNodes(q.Found)
+		q.Elapsed = time.Since(start)
+		q.Closest = closest
+		if trace != nil {
+			trace(q)
+		}
+	}
+}
+
+// lookupDistances computes the distance parameter for FINDNODE calls to dest.
+// It chooses distances adjacent to logdist(target, dest), e.g. for a target
+// with logdist(target, dest) = 255 the result is [255, 256, 254].
+func lookupDistances(target, dest enode.ID) (dists []uint) {
+	td := enode.LogDist(target, dest)
+	dists = append(dists, uint(td))
+	for i := 1; len(dists) < lookupRequestLimit; i++ {
+		if td+i <= 256 {
+			dists = append(dists, uint(td+i))
+		}
+		if td-i > 0 {
+			dists = append(dists, uint(td-i))
+		}
+	}
+	return dists
+}
@@ -0,0 +1,385 @@
+package session
+
+import (
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/wire"
+)
+
+const (
+	maxPacketSize  = 1280
+	defaultTimeout = 1 * time.Second
+	// The maximum number of NODES responses accepted for one FINDNODE.
+	maxNodesResponses = 5
+)
+
+var (
+	ErrTimeout = errors.New("the request reached the timeout")
+	errClosed  = errors.New("the client is closed")
+)
+
+// Config is a configuration used to create Client.
+type Config struct {
+	// The private key of the local node. If it's nil, a new key is generated.
+	PrivateKey *ecdsa.PrivateKey
+	// The time to wait for each response. If it's zero, one second is used.
+	Timeout time.Duration
+	// The protocol ID in the packet headers. If it's zero,
+	// wire.DefaultProtocolID is used.
+	ProtocolID [6]byte
+}
+
+type call struct {
+	nd  *enode.Node
+	msg v5wire.Packet
+	// Used to make sure that we answer at most one WHOAREYOU for each call.
+	handshakeSent bool
+	// The nonces of the packets sent for the call.
+	nonces []v5wire.Nonce
+	respCh chan v5wire.Packet
+}
+
+// Client is a discv5 node which only sends requests. Unlike measure.Client,
+// it does the handshake with the other nodes, so it can send any request and
+// read the responses.
+type Client struct {
+	config     *Config
+	privateKey *ecdsa.PrivateKey
+	ln         *enode.LocalNode
+	usocket    *net.UDPConn
+
+	// Used to access the maps below from multiple routines.
+	lock sync.Mutex
+	// The established sessions with the other nodes.
+	sessions map[enode.ID]*wire.SessionKeys
+	// The map used to find the active call by the nonce of the sent packet.
+	activeCallByNonce map[v5wire.Nonce]*call
+	// The map used to find the active call by the request ID.
+	activeCallByReqID map[string]*call
+
+	// Shutdown stuff.
+	closeOnce sync.Once
+	closed    chan struct{}
+	// Used to wait for the goroutines to finish.
+	loopWG sync.WaitGroup
+}
+
+func Listen(config *Config) (*Client, error) {
+	privateKey := config.PrivateKey
+	if privateKey == nil {
+		var err error
+		privateKey, err = crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.ProtocolID == ([6]byte{}) {
+		config.ProtocolID = wire.DefaultProtocolID()
+	}
+
+	// By putting the empty string, it will create a memory database instead
+	// of a persistent database.
+	db, err := enode.OpenDB("")
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new local ethereum p2p node.
+	ln := enode.NewLocalNode(db, privateKey)
+	// Bind to some UDP port.
+	addr := "0.0.0.0:0"
+	socket, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	usocket := socket.(*net.UDPConn)
+
+	// The record is sent in the handshake, so it needs an endpoint.
+	uaddr := socket.LocalAddr().(*net.UDPAddr)
+	if uaddr.IP.IsUnspecified() {
+		ln.SetFallbackIP(net.IP{127, 0, 0, 1})
+	} else {
+		ln.SetFallbackIP(uaddr.IP)
+	}
+	ln.SetFallbackUDP(uaddr.Port)
+
+	client := &Client{
+		config:     config,
+		privateKey: privateKey,
+		ln:         ln,
+		usocket:    usocket,
+
+		sessions:          make(map[enode.ID]*wire.SessionKeys),
+		activeCallByNonce: make(map[v5wire.Nonce]*call),
+		activeCallByReqID: make(map[string]*call),
+		closed:            make(chan struct{}),
+	}
+	client.loopWG.Add(1)
+	go client.readLoop()
+
+	return client, nil
+}
+
+// Self returns the record of the local node.
+func (c *Client) Self() *enode.Node {
+	return c.ln.Node()
+}
+
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.usocket.Close()
+		c.loopWG.Wait()
+	})
+}
+
+func (c *Client) readLoop() {
+	defer c.loopWG.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		nbytes, _, err := c.usocket.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		content := buf[:nbytes]
+		head, msgData, err := wire.DecodeRawPacketProtocol(content, c.ln.ID(), c.config.ProtocolID)
+		if err != nil {
+			continue
+		}
+		if _, err := wire.DecodeWhoareyouAuthData(head); err == nil {
+			c.handleWhoareyou(head)
+			continue
+		}
+		auth, err := wire.DecodeMessageAuthData(head)
+		if err != nil {
+			// We don't accept handshakes from the other nodes.
+			continue
+		}
+
+		c.lock.Lock()
+		keys := c.sessions[auth.SrcID]
+		c.lock.Unlock()
+		if keys == nil {
+			continue
+		}
+		msg, err := wire.DecryptMessage(head, msgData, keys.ReadKey)
+		if err != nil {
+			continue
+		}
+
+		c.lock.Lock()
+		cl, ok := c.activeCallByReqID[string(msg.RequestID())]
+		c.lock.Unlock()
+		if !ok || cl.nd.ID() != auth.SrcID {
+			continue
+		}
+		select {
+		case cl.respCh <- msg:
+		default:
+			// The caller has received enough responses.
+		}
+	}
+}
+
+// handleWhoareyou answers the WHOAREYOU challenge with a handshake packet
+// containing the message of the call.
+func (c *Client) handleWhoareyou(head *v5wire.Header) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cl, ok := c.activeCallByNonce[head.Nonce]
+	if !ok || cl.handshakeSent {
+		return
+	}
+	delete(c.activeCallByNonce, head.Nonce)
+	cl.handshakeSent = true
+
+	hhead, msgData, keys, err := wire.GenHandshakePacket(c.privateKey, c.ln.Node(), cl.nd, head, cl.msg)
+	if err != nil {
+		return
+	}
+	encoded, err := wire.EncodeRawPacket(cl.nd.ID(), hhead, msgData)
+	if err != nil {
+		return
+	}
+	c.sessions[cl.nd.ID()] = keys
+	c.usocket.WriteToUDP(encoded, &net.UDPAddr{IP: cl.nd.IP(), Port: cl.nd.UDP()})
+}
+
+// call sends the message to the node. If there is no session with the node,
+// a random packet is sent instead and the message is sent in the handshake.
+func (c *Client) call(nd *enode.Node, msg v5wire.Packet) (*call, error) {
+	reqID := make([]byte, 8)
+	if _, err := crand.Read(reqID); err != nil {
+		return nil, err
+	}
+	msg.SetRequestID(reqID)
+	cl := &call{
+		nd:     nd,
+		msg:    msg,
+		respCh: make(chan v5wire.Packet, maxNodesResponses),
+	}
+
+	c.lock.Lock()
+	var (
+		head    v5wire.Header
+		msgData []byte
+		err     error
+	)
+	if keys := c.sessions[nd.ID()]; keys != nil {
+		head, msgData, err = wire.GenMessagePacket(c.ln.ID(), keys, msg)
+	} else {
+		head, msgData, err = wire.GenRandomPacket(c.ln.ID(), nd.ID())
+		head.ProtocolID = c.config.ProtocolID
+	}
+	if err != nil {
+		c.lock.Unlock()
+		return nil, err
+	}
+	// Even if there is a session, the node may have forgotten it and sends a
+	// WHOAREYOU back.
+	c.activeCallByNonce[head.Nonce] = cl
+	cl.nonces = append(cl.nonces, head.Nonce)
+	c.activeCallByReqID[string(reqID)] = cl
+	c.lock.Unlock()
+
+	encoded, err := wire.EncodeRawPacket(nd.ID(), head, msgData)
+	if err == nil {
+		_, err = c.usocket.WriteToUDP(encoded, &net.UDPAddr{IP: nd.IP(), Port: nd.UDP()})
+	}
+	if err != nil {
+		c.callDone(cl)
+		return nil, err
+	}
+	return cl, nil
+}
+
+func (c *Client) callDone(cl *call) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, nonce := range cl.nonces {
+		delete(c.activeCallByNonce, nonce)
+	}
+	delete(c.activeCallByReqID, string(cl.msg.RequestID()))
+}
+
+// wait waits for the next response of the call.
+func (c *Client) wait(cl *call) (v5wire.Packet, error) {
+	select {
+	case msg := <-cl.respCh:
+		return msg, nil
+	case <-time.After(c.config.Timeout):
+		return nil, ErrTimeout
+	case <-c.closed:
+		return nil, errClosed
+	}
+}
+
+// Ping sends a PING request to the node and returns the PONG response and the
+// time it takes to get the response.
+func (c *Client) Ping(nd *enode.Node) (*v5wire.Pong, time.Duration, error) {
+	start := time.Now()
+	cl, err := c.call(nd, &v5wire.Ping{ENRSeq: c.ln.Node().Seq()})
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	defer c.callDone(cl)
+
+	msg, err := c.wait(cl)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	pong, ok := msg.(*v5wire.Pong)
+	if !ok {
+		return nil, time.Since(start), fmt.Errorf("unexpected response %s", msg.Name())
+	}
+	return pong, time.Since(start), nil
+}
+
+// Findnode sends a FINDNODE request with the given distances to the node and
+// returns the nodes in the responses and the time it takes to get the first
+// response.
+func (c *Client) Findnode(nd *enode.Node, distances []uint) ([]*enode.Node, time.Duration, error) {
+	resps, latency, err := c.FindnodeResponses(nd, distances)
+	var (
+		nodes []*enode.Node
+		seen  = make(map[enode.ID]bool)
+	)
+	for _, resp := range resps {
+		for _, record := range resp.Nodes {
+			n, err := enode.New(enode.ValidSchemes, record)
+			if err != nil || seen[n.ID()] {
+				continue
+			}
+			seen[n.ID()] = true
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, latency, err
+}
+
+// FindnodeResponses is like Findnode, but it returns the NODES responses as
+// they are. If some responses are lost, the received ones are returned with
+// the error.
+func (c *Client) FindnodeResponses(nd *enode.Node, distances []uint) ([]*v5wire.Nodes, time.Duration, error) {
+	start := time.Now()
+	cl, err := c.call(nd, &v5wire.Findnode{Distances: distances})
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	defer c.callDone(cl)
+
+	var (
+		resps           []*v5wire.Nodes
+		latency         time.Duration
+		received, total = 0, -1
+	)
+	for received != total {
+		msg, err := c.wait(cl)
+		if err != nil {
+			if received == 0 {
+				return nil, time.Since(start), err
+			}
+			return resps, latency, err
+		}
+		resp, ok := msg.(*v5wire.Nodes)
+		if !ok {
+			return nil, time.Since(start), fmt.Errorf("unexpected response %s", msg.Name())
+		}
+		if received == 0 {
+			latency = time.Since(start)
+			total = int(resp.Total)
+			if total < 1 {
+				total = 1
+			} else if total > maxNodesResponses {
+				total = maxNodesResponses
+			}
+		}
+		received++
+		resps = append(resps, resp)
+	}
+	return resps, latency, nil
+}
+
+// RequestENR requests the current record of the node.
+func (c *Client) RequestENR(nd *enode.Node) (*enode.Node, error) {
+	nodes, _, err := c.Findnode(nd, []uint{0})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, fmt.Errorf("%d nodes in response for distance zero", len(nodes))
+	}
+	return nodes[0], nil
+}
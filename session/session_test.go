@@ -0,0 +1,80 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/internal/testnode"
+)
+
+func TestPingAndRequestENR(t *testing.T) {
+	nd := testnode.StartV5(t, nil).Self()
+	c, err := Listen(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The first request is sent in the handshake.
+	pong, _, err := c.Ping(nd)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if pong.ENRSeq != nd.Seq() {
+		t.Errorf("wrong ENR seq in PONG: got %d, want %d", pong.ENRSeq, nd.Seq())
+	}
+	// The second request uses the established session.
+	got, err := c.RequestENR(nd)
+	if err != nil {
+		t.Fatalf("requesting ENR failed: %v", err)
+	}
+	if got.ID() != nd.ID() {
+		t.Errorf("wrong node in response: got %v, want %v", got.ID(), nd.ID())
+	}
+}
+
+func TestLookup(t *testing.T) {
+	boot := testnode.StartV5(t, nil).Self()
+	var nodes []*enode.Node
+	for i := 0; i < 5; i++ {
+		disc := testnode.StartV5(t, []*enode.Node{boot})
+		// Make the bootnode know the node.
+		if err := disc.Ping(boot); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, disc.Self())
+	}
+	c, err := Listen(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	target := nodes[len(nodes)-1].ID()
+	queries := 0
+	result := c.Lookup(target, []*enode.Node{boot}, func(q *Query) {
+		queries++
+	})
+	if queries == 0 {
+		t.Fatal("no query was done")
+	}
+	if len(result) == 0 || result[0].ID() != target {
+		t.Errorf("the target isn't the closest node found: %v", result)
+	}
+}
+
+func TestProtocolIDMismatch(t *testing.T) {
+	nd := testnode.StartV5(t, nil).Self()
+	c, err := Listen(&Config{ProtocolID: [6]byte{'p', 'o', 'r', 't', 'a', 'l'}, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The node drops the packets with another protocol ID.
+	if _, _, err := c.Ping(nd); !errors.Is(err, ErrTimeout) {
+		t.Errorf("ping returns %v, want %v", err, ErrTimeout)
+	}
+}
@@ -0,0 +1,154 @@
+package snapshot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/record"
+)
+
+// The default thresholds of the measurement changes reported.
+const (
+	DefaultRttThreshold  = 50 * time.Millisecond
+	DefaultLossThreshold = 0.1
+)
+
+// DiffConfig is a configuration used to compare node sets.
+type DiffConfig struct {
+	// The RTT and loss rate changes smaller than these aren't reported. If
+	// they're zero, the default values are used.
+	RttThreshold  time.Duration
+	LossThreshold float64
+}
+
+// SeqChange is a change of the ENR seq of a node.
+type SeqChange struct {
+	ID       string
+	Old, New uint64
+}
+
+// Change is a change of a string field of a node.
+type Change struct {
+	ID       string
+	Old, New string
+}
+
+// RttChange is a change of the measured RTT of a node.
+type RttChange struct {
+	ID              string
+	Old, New, Delta time.Duration
+}
+
+// LossChange is a change of the measured loss rate of a node.
+type LossChange struct {
+	ID              string
+	Old, New, Delta float64
+}
+
+// Diff is the difference between two node sets.
+type Diff struct {
+	// The IDs of the nodes only in the new set and only in the old set.
+	Joined []string
+	Left   []string
+	// The number of the nodes in both sets.
+	Common int
+
+	SeqBumps []SeqChange
+	// The changes of the IP address and the UDP port.
+	EndpointChanges   []Change
+	ForkDigestChanges []Change
+	RttChanges        []RttChange
+	LossChanges       []LossChange
+}
+
+// parsed is a node object with the parsed ENR.
+type parsed struct {
+	n  *Node
+	nd *enode.Node
+}
+
+func index(nodes []Node) (map[enode.ID]parsed, error) {
+	m := make(map[enode.ID]parsed)
+	for i := range nodes {
+		nd, err := nodes[i].Node()
+		if err != nil {
+			return nil, err
+		}
+		m[nd.ID()] = parsed{&nodes[i], nd}
+	}
+	return m, nil
+}
+
+func endpoint(nd *enode.Node) string {
+	return fmt.Sprintf("%v:%d", nd.IP(), nd.UDP())
+}
+
+// Compare compares the old node set with the new one. All the lists in the
+// result are sorted by the node ID.
+func Compare(oldNodes, newNodes []Node, config *DiffConfig) (*Diff, error) {
+	rttThreshold := config.RttThreshold
+	if rttThreshold == 0 {
+		rttThreshold = DefaultRttThreshold
+	}
+	lossThreshold := config.LossThreshold
+	if lossThreshold == 0 {
+		lossThreshold = DefaultLossThreshold
+	}
+	oldSet, err := index(oldNodes)
+	if err != nil {
+		return nil, err
+	}
+	newSet, err := index(newNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{}
+	for id := range oldSet {
+		if _, ok := newSet[id]; !ok {
+			d.Left = append(d.Left, id.String())
+		}
+	}
+	var common []enode.ID
+	for id := range newSet {
+		if _, ok := oldSet[id]; ok {
+			common = append(common, id)
+		} else {
+			d.Joined = append(d.Joined, id.String())
+		}
+	}
+	sort.Strings(d.Left)
+	sort.Strings(d.Joined)
+	sort.Slice(common, func(i, j int) bool { return common[i].String() < common[j].String() })
+	d.Common = len(common)
+
+	for _, id := range common {
+		o, n := oldSet[id], newSet[id]
+		sid := id.String()
+		if o.nd.Seq() != n.nd.Seq() {
+			d.SeqBumps = append(d.SeqBumps, SeqChange{sid, o.nd.Seq(), n.nd.Seq()})
+		}
+		if oe, ne := endpoint(o.nd), endpoint(n.nd); oe != ne {
+			d.EndpointChanges = append(d.EndpointChanges, Change{sid, oe, ne})
+		}
+		if of, nf := record.ForkDigest(o.nd.Record()), record.ForkDigest(n.nd.Record()); of != nf {
+			d.ForkDigestChanges = append(d.ForkDigestChanges, Change{sid, of, nf})
+		}
+
+		or, nr := o.n.Result, n.n.Result
+		// The RTT of a node which doesn't respond means nothing.
+		if or.LossRate < 1 && nr.LossRate < 1 {
+			delta := nr.Rtt - or.Rtt
+			if delta >= rttThreshold || -delta >= rttThreshold {
+				d.RttChanges = append(d.RttChanges, RttChange{sid, or.Rtt, nr.Rtt, delta})
+			}
+		}
+		if delta := nr.LossRate - or.LossRate; math.Abs(delta) >= lossThreshold {
+			d.LossChanges = append(d.LossChanges, LossChange{sid, or.LossRate, nr.LossRate, delta})
+		}
+	}
+	return d, nil
+}
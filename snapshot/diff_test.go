@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppopth/discv5-tools/measure"
+)
+
+func TestCompare(t *testing.T) {
+	stayed, withSeq := testNode(t, 1)
+	bumped := withSeq(2)
+	left, _ := testNode(t, 1)
+	joined, _ := testNode(t, 1)
+
+	oldNodes := []Node{
+		{NodeUrl: stayed.String(), Result: measure.Result{Rtt: 20 * time.Millisecond}},
+		{NodeUrl: left.String(), Result: measure.Result{Rtt: 20 * time.Millisecond}},
+	}
+	newNodes := []Node{
+		{NodeUrl: bumped.String(), Result: measure.Result{Rtt: 100 * time.Millisecond, LossRate: 0.05}},
+		{NodeUrl: joined.String(), Result: measure.Result{Rtt: 20 * time.Millisecond}},
+	}
+	d, err := Compare(oldNodes, newNodes, &DiffConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Joined) != 1 || d.Joined[0] != joined.ID().String() {
+		t.Errorf("wrong joined nodes: %v", d.Joined)
+	}
+	if len(d.Left) != 1 || d.Left[0] != left.ID().String() {
+		t.Errorf("wrong left nodes: %v", d.Left)
+	}
+	if d.Common != 1 {
+		t.Errorf("got %d common nodes, want 1", d.Common)
+	}
+	if len(d.SeqBumps) != 1 || d.SeqBumps[0].Old != 1 || d.SeqBumps[0].New != 2 {
+		t.Errorf("wrong seq bumps: %+v", d.SeqBumps)
+	}
+	if len(d.EndpointChanges) != 0 || len(d.ForkDigestChanges) != 0 {
+		t.Errorf("unexpected changes: %+v %+v", d.EndpointChanges, d.ForkDigestChanges)
+	}
+	if len(d.RttChanges) != 1 || d.RttChanges[0].Delta != 80*time.Millisecond {
+		t.Errorf("wrong rtt changes: %+v", d.RttChanges)
+	}
+	// The loss rate change is below the default threshold.
+	if len(d.LossChanges) != 0 {
+		t.Errorf("wrong loss changes: %+v", d.LossChanges)
+	}
+}
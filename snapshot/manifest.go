@@ -0,0 +1,112 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Manifest describes the run which produced a node set file, so that the
+// datasets can be compared and reproduced later. It's stored next to the node
+// set file, see ManifestFile.
+type Manifest struct {
+	// The name of the tool and its version from the build information.
+	Tool    string
+	Version string
+	Args    []string
+	// The boot nodes used, if the run crawled the network, and the node IDs
+	// of the local nodes. The IDs of the crawler come before the ID of the
+	// measurement client.
+	BootNodes []string `json:",omitempty"`
+	LocalIDs  []string `json:",omitempty"`
+	Vantage   string   `json:",omitempty"`
+	// The options of the run, e.g. the values of the command-line flags.
+	Config map[string]interface{}
+	// The time when the run started and when it ended or, if it's still
+	// running, when the node set file was last written.
+	StartedAt time.Time
+	EndedAt   time.Time
+	// The counters of the run, e.g. the number of nodes measured.
+	Counts map[string]int64
+	Host   Host
+}
+
+// Host is the information of the host which the tool ran on.
+type Host struct {
+	Hostname  string
+	OS        string
+	Arch      string
+	NumCPU    int
+	GoVersion string
+}
+
+// NewManifest creates a manifest of the running tool started now.
+func NewManifest(tool string) *Manifest {
+	hostname, _ := os.Hostname()
+	return &Manifest{
+		Tool:      tool,
+		Version:   version(),
+		Args:      os.Args[1:],
+		Config:    make(map[string]interface{}),
+		StartedAt: time.Now(),
+		Counts:    make(map[string]int64),
+		Host: Host{
+			Hostname:  hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			NumCPU:    runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+	}
+}
+
+// version returns the module version and the VCS revision of the binary.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := info.Main.Version
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision":
+			v += " " + s.Value
+		case s.Key == "vcs.modified" && s.Value == "true":
+			v += " (modified)"
+		}
+	}
+	return v
+}
+
+// ManifestFile returns the name of the manifest file of the node set file,
+// e.g. "nodes.manifest.json" for "nodes.json".
+func ManifestFile(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".manifest.json"
+}
+
+// ReadManifest reads the manifest of the node set file.
+func ReadManifest(file string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(ManifestFile(file))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// WriteManifest writes the manifest of the node set file.
+func WriteManifest(file string, m *Manifest) error {
+	text, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ManifestFile(file), text, 0644)
+}
@@ -0,0 +1,39 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestFile(t *testing.T) {
+	tests := map[string]string{
+		"nodes.json":     "nodes.manifest.json",
+		"dir/nodes":      "dir/nodes.manifest.json",
+		"a.b/nodes.json": "a.b/nodes.manifest.json",
+	}
+	for file, want := range tests {
+		if got := ManifestFile(file); got != want {
+			t.Errorf("ManifestFile(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nodes.json")
+	m := NewManifest("test")
+	m.Config["timeout"] = "3s"
+	m.Counts["nodes"] = 42
+	if err := WriteManifest(file, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadManifest(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tool != "test" || got.Config["timeout"] != "3s" || got.Counts["nodes"] != 42 {
+		t.Errorf("wrong manifest: %+v", got)
+	}
+	if !got.StartedAt.Equal(m.StartedAt) || got.Host != m.Host {
+		t.Errorf("wrong time or host: %+v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package snapshot
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+)
+
+// VantageResult is the result of measuring a node from one vantage point.
+type VantageResult struct {
+	Vantage     string
+	Result      measure.Result
+	RefreshedAt time.Time
+}
+
+// MergedNode is a node measured from one or more vantage points.
+type MergedNode struct {
+	// The newest ENR of the node among the vantage points.
+	NodeUrl string
+	// The discovery protocol which the node was measured with.
+	Protocol string
+	Results  []VantageResult
+	// The vantage point with the lowest RTT among the ones which got at least
+	// one response. It's empty if no vantage point did.
+	ClosestVantage string
+	MinRtt         time.Duration
+	MaxRtt         time.Duration
+	// The difference between MaxRtt and MinRtt. A node close to one vantage
+	// point and far from the others has a large spread.
+	RttSpread time.Duration
+}
+
+// mergeKey identifies a merged node. The results of the same node measured
+// with discv4 and discv5 aren't comparable, so they are kept apart.
+type mergeKey struct {
+	id       enode.ID
+	protocol string
+}
+
+// Merge combines the node sets measured from different vantage points into
+// per-node results. The vantage ID of each node object must be set. The
+// merged nodes are sorted by the node ID and then by the protocol.
+func Merge(sets ...[]Node) ([]*MergedNode, error) {
+	var (
+		merged = make(map[mergeKey]*MergedNode)
+		newest = make(map[mergeKey]*enode.Node)
+	)
+	for _, set := range sets {
+		for _, n := range set {
+			nd, err := n.Node()
+			if err != nil {
+				return nil, err
+			}
+			key := mergeKey{nd.ID(), n.Protocol}
+			if key.protocol == "" {
+				key.protocol = measure.Discv5
+			}
+			m, ok := merged[key]
+			if !ok {
+				m = &MergedNode{Protocol: key.protocol}
+				merged[key] = m
+			}
+			if old := newest[key]; old == nil || nd.Seq() > old.Seq() {
+				newest[key] = nd
+				m.NodeUrl = n.NodeUrl
+			}
+			m.Results = append(m.Results, VantageResult{n.Vantage, n.Result, n.RefreshedAt})
+		}
+	}
+
+	var keys []mergeKey
+	for key, m := range merged {
+		keys = append(keys, key)
+		sort.Slice(m.Results, func(i, j int) bool { return m.Results[i].Vantage < m.Results[j].Vantage })
+		m.summarize()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].id != keys[j].id {
+			return string(keys[i].id[:]) < string(keys[j].id[:])
+		}
+		return keys[i].protocol < keys[j].protocol
+	})
+	var nodes []*MergedNode
+	for _, key := range keys {
+		nodes = append(nodes, merged[key])
+	}
+	return nodes, nil
+}
+
+// summarize computes the triangulation summary from the results. The results
+// without any response don't have an RTT, so they are skipped.
+func (m *MergedNode) summarize() {
+	first := true
+	for _, r := range m.Results {
+		if r.Result.LossRate >= 1 {
+			continue
+		}
+		if first || r.Result.Rtt < m.MinRtt {
+			m.MinRtt = r.Result.Rtt
+			m.ClosestVantage = r.Vantage
+		}
+		if first || r.Result.Rtt > m.MaxRtt {
+			m.MaxRtt = r.Result.Rtt
+		}
+		first = false
+	}
+	m.RttSpread = m.MaxRtt - m.MinRtt
+}
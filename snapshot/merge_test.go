@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ppopth/discv5-tools/measure"
+)
+
+func testNode(t *testing.T, seq uint64) (*enode.Node, func(uint64) *enode.Node) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(seq uint64) *enode.Node {
+		var r enr.Record
+		r.Set(enr.IP(net.IP{10, 0, 0, 1}))
+		r.Set(enr.UDP(9000))
+		r.SetSeq(seq)
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+		nd, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	return sign(seq), sign
+}
+
+// TestMerge simulates two vantage points with different delays to the same
+// node.
+func TestMerge(t *testing.T) {
+	nd, withSeq := testNode(t, 1)
+	newer := withSeq(2)
+	unreachable, _ := testNode(t, 1)
+
+	east := []Node{
+		{NodeUrl: nd.String(), Vantage: "east", Result: measure.Result{Rtt: 20 * time.Millisecond}},
+		{NodeUrl: unreachable.String(), Vantage: "east", Result: measure.Result{LossRate: 1}},
+	}
+	west := []Node{
+		{NodeUrl: newer.String(), Vantage: "west", Result: measure.Result{Rtt: 150 * time.Millisecond}},
+	}
+	merged, err := Merge(west, east)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("got %d merged nodes, want 2", len(merged))
+	}
+	for _, m := range merged {
+		switch m.NodeUrl {
+		case newer.String():
+			if len(m.Results) != 2 || m.Results[0].Vantage != "east" {
+				t.Errorf("wrong results: %+v", m.Results)
+			}
+			if m.ClosestVantage != "east" || m.RttSpread != 130*time.Millisecond {
+				t.Errorf("wrong summary: closest=%s spread=%v", m.ClosestVantage, m.RttSpread)
+			}
+		case unreachable.String():
+			if m.ClosestVantage != "" {
+				t.Errorf("the unreachable node has the closest vantage %s", m.ClosestVantage)
+			}
+		default:
+			t.Errorf("unexpected node %s", m.NodeUrl)
+		}
+	}
+}
+
+// TestMergeProtocols checks that the discv4 and discv5 results of the same
+// node are kept apart.
+func TestMergeProtocols(t *testing.T) {
+	nd, _ := testNode(t, 1)
+
+	east := []Node{
+		{NodeUrl: nd.String(), Vantage: "east", Result: measure.Result{Rtt: 20 * time.Millisecond}},
+		{NodeUrl: nd.String(), Vantage: "east", Protocol: measure.Discv4, Result: measure.Result{Rtt: 30 * time.Millisecond}},
+	}
+	west := []Node{
+		{NodeUrl: nd.String(), Vantage: "west", Protocol: measure.Discv5, Result: measure.Result{Rtt: 150 * time.Millisecond}},
+	}
+	merged, err := Merge(east, west)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("got %d merged nodes, want 2", len(merged))
+	}
+	if m := merged[0]; m.Protocol != measure.Discv4 || len(m.Results) != 1 || m.MinRtt != 30*time.Millisecond {
+		t.Errorf("wrong discv4 node: %+v", m)
+	}
+	if m := merged[1]; m.Protocol != measure.Discv5 || len(m.Results) != 2 || m.RttSpread != 130*time.Millisecond {
+		t.Errorf("wrong discv5 node: %+v", m)
+	}
+}
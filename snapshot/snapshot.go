@@ -0,0 +1,75 @@
+// Package snapshot reads and writes the node set files of network-measure.
+package snapshot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ppopth/discv5-tools/measure"
+)
+
+// Node is a node object in the node set file.
+type Node struct {
+	NodeUrl string
+	Result  measure.Result
+	// The address which the node responds from, if it's not the endpoint in
+	// the record.
+	StaleEndpoint string `json:",omitempty"`
+	// The ID of the vantage point which measured the node, if it's given.
+	Vantage string `json:",omitempty"`
+	// The discovery protocol which the node was measured with. The files
+	// written before the protocol was recorded are all discv5.
+	Protocol string `json:",omitempty"`
+	// The error which the measurement of the node failed with, if any. The
+	// result is then the part measured before the error, or the loss rate of
+	// 1 if nothing was measured.
+	Error string `json:",omitempty"`
+
+	RefreshedAt time.Time
+	UpdatedAt   time.Time
+}
+
+// Node parses the ENR of the node.
+func (n *Node) Node() (*enode.Node, error) {
+	return enode.Parse(enode.ValidSchemes, n.NodeUrl)
+}
+
+// ReadFile reads the node set file.
+func ReadFile(file string) ([]Node, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []Node
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// WriteFile writes the nodes to the node set file.
+func WriteFile(file string, nodes []Node) error {
+	if nodes == nil {
+		nodes = []Node{}
+	}
+	text, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(text); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,63 @@
+package wire
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+)
+
+// NewHeader builds a packet header with the given flag and auth data. The
+// masking IV and the nonce are random and the protocol ID is
+// DefaultProtocolID. The header can be modified before it's encoded with
+// EncodeRawPacket, e.g. to answer a packet with its nonce or to use another
+// protocol ID.
+func NewHeader(flag byte, authData []byte) (v5wire.Header, error) {
+	head := v5wire.Header{
+		StaticHeader: v5wire.StaticHeader{
+			ProtocolID: DefaultProtocolID(),
+			Version:    version,
+			Flag:       flag,
+			AuthSize:   uint16(len(authData)),
+		},
+		AuthData: authData,
+	}
+	if _, err := crand.Read(head.Nonce[:]); err != nil {
+		return head, fmt.Errorf("can't get random data: %v", err)
+	}
+	if _, err := crand.Read(head.IV[:]); err != nil {
+		return head, fmt.Errorf("can't get random data: %v", err)
+	}
+	return head, nil
+}
+
+// Encode encodes the auth data as it's put in the packet.
+func (auth *WhoareyouAuthData) Encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, auth)
+	return buf.Bytes()
+}
+
+// Encode encodes the auth data as it's put in the packet.
+func (auth *MessageAuthData) Encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, auth)
+	return buf.Bytes()
+}
+
+// Encode encodes the auth data as it's put in the packet. The sizes of the
+// signature and the public key are taken from the fields.
+func (auth *HandshakeAuthData) Encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, handshakeAuthHeader{
+		SrcID:      auth.SrcID,
+		SigSize:    byte(len(auth.Signature)),
+		PubkeySize: byte(len(auth.Pubkey)),
+	})
+	buf.Write(auth.Signature)
+	buf.Write(auth.Pubkey)
+	buf.Write(auth.Record)
+	return buf.Bytes()
+}
@@ -0,0 +1,108 @@
+package wire
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encryption parameters.
+const (
+	aesKeySize   = 16
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// SessionKeys contains the keys of an established session with a node.
+type SessionKeys struct {
+	WriteKey []byte
+	ReadKey  []byte
+	// The protocol ID of the packets of the session. If it's zero,
+	// DefaultProtocolID is used.
+	ProtocolID [6]byte
+}
+
+// idNonceHash computes the ID signature hash used in the handshake.
+func idNonceHash(challenge, ephkey []byte, destID enode.ID) []byte {
+	h := sha256.New()
+	h.Write([]byte("discovery v5 identity proof"))
+	h.Write(challenge)
+	h.Write(ephkey)
+	h.Write(destID[:])
+	return h.Sum(nil)
+}
+
+// makeIDSignature creates the ID nonce signature.
+func makeIDSignature(key *ecdsa.PrivateKey, challenge, ephkey []byte, destID enode.ID) ([]byte, error) {
+	idsig, err := crypto.Sign(idNonceHash(challenge, ephkey, destID), key)
+	if err != nil {
+		return nil, err
+	}
+	// Remove the recovery ID.
+	return idsig[:len(idsig)-1], nil
+}
+
+// deriveKeys creates the session keys of the initiator. The recipient has to
+// swap the keys.
+func deriveKeys(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, n1, n2 enode.ID, challenge []byte) *SessionKeys {
+	const text = "discovery v5 key agreement"
+	var info = make([]byte, 0, len(text)+len(n1)+len(n2))
+	info = append(info, text...)
+	info = append(info, n1[:]...)
+	info = append(info, n2[:]...)
+
+	eph := ecdh(priv, pub)
+	if eph == nil {
+		return nil
+	}
+	kdf := hkdf.New(sha256.New, eph, challenge, info)
+	keys := &SessionKeys{WriteKey: make([]byte, aesKeySize), ReadKey: make([]byte, aesKeySize)}
+	kdf.Read(keys.WriteKey)
+	kdf.Read(keys.ReadKey)
+	return keys
+}
+
+// ecdh creates a shared secret.
+func ecdh(privkey *ecdsa.PrivateKey, pubkey *ecdsa.PublicKey) []byte {
+	secX, secY := pubkey.ScalarMult(pubkey.X, pubkey.Y, privkey.D.Bytes())
+	if secX == nil {
+		return nil
+	}
+	sec := make([]byte, 33)
+	sec[0] = 0x02 | byte(secY.Bit(0))
+	math.ReadBits(secX, sec[1:])
+	return sec
+}
+
+// encryptGCM encrypts pt using AES-GCM with the given key and nonce.
+func encryptGCM(key, nonce, pt, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't create block cipher: %v", err)
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM: %v", err)
+	}
+	return aesgcm.Seal(nil, nonce, pt, authData), nil
+}
+
+// decryptGCM decrypts ct using AES-GCM with the given key and nonce.
+func decryptGCM(key, nonce, ct, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't create block cipher: %v", err)
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM: %v", err)
+	}
+	return aesgcm.Open(nil, nonce, ct, authData)
+}
@@ -1,25 +1,40 @@
+// Package wire encodes and decodes discv5 packets. It can build any kind of
+// packet, including malformed ones, so it is used to probe other nodes.
 package wire
 
 import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
 	crand "crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // Packet header flag values.
 const (
-	flagMessage = iota
-	flagWhoareyou
-	flagHandshake
+	FlagMessage = iota
+	FlagWhoareyou
+	FlagHandshake
 )
 
+var flagNames = []string{"message", "whoareyou", "handshake"}
+
+// FlagName returns the name of the packet header flag.
+func FlagName(flag byte) string {
+	if int(flag) < len(flagNames) {
+		return flagNames[flag]
+	}
+	return fmt.Sprintf("unknown(%d)", flag)
+}
+
 // Protocol constants.
 const (
 	version         = 1
@@ -27,36 +42,75 @@ const (
 	sizeofMaskingIV = 16
 
 	randomPacketMsgSize = 20
+	// MaxPacketSize is the maximum size of discv5 packets.
+	MaxPacketSize = 1280
 )
 
-var protocolID = [6]byte{'d', 'i', 's', 'c', 'v', '5'}
+// DefaultProtocolID returns the protocol ID in the headers of discv5 packets.
+// Some networks derived from discv5 use other protocol IDs.
+func DefaultProtocolID() [6]byte {
+	return [6]byte{'d', 'i', 's', 'c', 'v', '5'}
+}
+
+// ParseProtocolID parses a protocol ID, which must be exactly 6 bytes long,
+// e.g. "discv5".
+func ParseProtocolID(s string) ([6]byte, error) {
+	var id [6]byte
+	if len(s) != len(id) {
+		return id, fmt.Errorf("the protocol ID must be %d bytes long, got %q", len(id), s)
+	}
+	copy(id[:], s)
+	return id, nil
+}
 
 type (
-	whoareyouAuthData struct {
+	// WhoareyouAuthData is the auth data of WHOAREYOU packets.
+	WhoareyouAuthData struct {
 		IDNonce   [16]byte // ID proof data
 		RecordSeq uint64   // highest known ENR sequence of requester
 	}
 
-	messageAuthData struct {
+	// MessageAuthData is the auth data of ordinary message packets.
+	MessageAuthData struct {
 		SrcID enode.ID
 	}
+
+	// HandshakeAuthData is the auth data of handshake packets.
+	HandshakeAuthData struct {
+		SrcID     enode.ID
+		Signature []byte // ID nonce signature
+		Pubkey    []byte // ephemeral public key
+		Record    []byte // RLP-encoded ENR, if any
+	}
+
+	// The fixed-size part of the handshake auth data.
+	handshakeAuthHeader struct {
+		SrcID      enode.ID
+		SigSize    byte // size of the ID nonce signature
+		PubkeySize byte // size of the ephemeral public key
+	}
 )
 
 // Packet sizes.
 var (
 	sizeofStaticHeader      = binary.Size(v5wire.StaticHeader{})
-	sizeofWhoareyouAuthData = binary.Size(whoareyouAuthData{})
-	sizeofMessageAuthData   = binary.Size(messageAuthData{})
+	sizeofWhoareyouAuthData = binary.Size(WhoareyouAuthData{})
+	sizeofMessageAuthData   = binary.Size(MessageAuthData{})
+	sizeofHandshakeAuthData = binary.Size(handshakeAuthHeader{})
 	sizeofStaticPacketData  = sizeofMaskingIV + sizeofStaticHeader
 )
 
-// Errors.
+// Errors. The errors returned by the functions of the package can be matched
+// against them with errors.Is.
 var (
-	errTooShort      = errors.New("packet too short")
-	errInvalidHeader = errors.New("invalid packet header")
-	errInvalidFlag   = errors.New("invalid flag value in header")
-	errMinVersion    = errors.New("version of packet header below minimum")
-	errAuthSize      = errors.New("declared auth size is beyond packet length")
+	ErrTooShort        = errors.New("packet too short")
+	ErrInvalidHeader   = errors.New("invalid packet header")
+	ErrInvalidFlag     = errors.New("invalid flag value in header")
+	ErrMinVersion      = errors.New("version of packet header below minimum")
+	ErrAuthSize        = errors.New("declared auth size is beyond packet length")
+	ErrInvalidAuthSize = errors.New("invalid auth size")
+	ErrMsgDecrypt      = errors.New("cannot decrypt message")
+	ErrMsgTooShort     = errors.New("message contains no data")
 )
 
 func EncodeRawPacket(id enode.ID, head v5wire.Header, msgdata []byte) ([]byte, error) {
@@ -80,9 +134,18 @@ func EncodeRawPacket(id enode.ID, head v5wire.Header, msgdata []byte) ([]byte, e
 	return buf.Bytes(), nil
 }
 
+// DecodeRawPacket decodes the header of a discv5 packet sent to the node and
+// returns it with the message data. The packets with other protocol IDs are
+// rejected with ErrInvalidHeader.
 func DecodeRawPacket(input []byte, toID enode.ID) (*v5wire.Header, []byte, error) {
+	return DecodeRawPacketProtocol(input, toID, DefaultProtocolID())
+}
+
+// DecodeRawPacketProtocol is like DecodeRawPacket, but it accepts the packets
+// with the given protocol ID instead.
+func DecodeRawPacketProtocol(input []byte, toID enode.ID, protocolID [6]byte) (*v5wire.Header, []byte, error) {
 	if len(input) < sizeofStaticPacketData {
-		return nil, nil, errTooShort
+		return nil, nil, ErrTooShort
 	}
 	var head v5wire.Header
 	copy(head.IV[:], input[:sizeofMaskingIV])
@@ -102,13 +165,13 @@ func DecodeRawPacket(input []byte, toID enode.ID) (*v5wire.Header, []byte, error
 
 	// Check validity of the static header.
 	if head.ProtocolID != protocolID {
-		return nil, nil, errInvalidHeader
+		return nil, nil, ErrInvalidHeader
 	}
 	if head.Version < minVersion {
-		return nil, nil, errMinVersion
+		return nil, nil, ErrMinVersion
 	}
 	if int(head.AuthSize) > len(input[sizeofStaticPacketData:]) {
-		return nil, nil, errAuthSize
+		return nil, nil, ErrAuthSize
 	}
 
 	// Unmask auth data.
@@ -120,13 +183,13 @@ func DecodeRawPacket(input []byte, toID enode.ID) (*v5wire.Header, []byte, error
 	return &head, input[authDataEnd:], nil
 }
 
-func DecodeWhoareyouAuthData(head *v5wire.Header) (whoareyouAuthData, error) {
-	var auth whoareyouAuthData
-	if head.Flag != flagWhoareyou {
-		return auth, errInvalidFlag
+func DecodeWhoareyouAuthData(head *v5wire.Header) (WhoareyouAuthData, error) {
+	var auth WhoareyouAuthData
+	if head.Flag != FlagWhoareyou {
+		return auth, ErrInvalidFlag
 	}
 	if len(head.AuthData) != sizeofWhoareyouAuthData {
-		return auth, fmt.Errorf("invalid auth size %d for WHOAREYOU", len(head.AuthData))
+		return auth, fmt.Errorf("%w %d for WHOAREYOU", ErrInvalidAuthSize, len(head.AuthData))
 	}
 	var reader bytes.Reader
 	reader.Reset(head.AuthData)
@@ -134,32 +197,216 @@ func DecodeWhoareyouAuthData(head *v5wire.Header) (whoareyouAuthData, error) {
 	return auth, nil
 }
 
+// GenRandomPacket generates an ordinary message packet with random message
+// data. The receiver can't decrypt it, so it answers with a WHOAREYOU packet.
 func GenRandomPacket(fromID enode.ID, toID enode.ID) (v5wire.Header, []byte, error) {
-	head := v5wire.Header{
-		StaticHeader: v5wire.StaticHeader{
-			ProtocolID: protocolID,
-			Version:    version,
-			Flag:       flagMessage,
-			AuthSize:   uint16(sizeofMessageAuthData),
-		},
+	return GenRandomPacketSize(fromID, toID, RandomPacketSize)
+}
+
+// The size of the message packets without the message data, i.e. the masking
+// IV, the 23-byte static header and the 32-byte source ID. It's spelled out,
+// so that the sizes below are constants.
+const sizeofMessageHeader = sizeofMaskingIV + 23 + 32
+
+// RandomPacketSize is the size of the packets generated by GenRandomPacket.
+const RandomPacketSize = sizeofMessageHeader + randomPacketMsgSize
+
+// MinRandomPacketSize is the minimum size of the packets generated by
+// GenRandomPacketSize. The message data must be at least as long as the GCM
+// tag, otherwise the receiver drops the packet without answering.
+const MinRandomPacketSize = sizeofMessageHeader + gcmTagSize
+
+// GenRandomPacketSize is like GenRandomPacket, but the encoded packet has the
+// given size, which must be between MinRandomPacketSize and MaxPacketSize.
+func GenRandomPacketSize(fromID enode.ID, toID enode.ID, size int) (v5wire.Header, []byte, error) {
+	if size < MinRandomPacketSize || size > MaxPacketSize {
+		return v5wire.Header{}, nil, fmt.Errorf("invalid packet size %d", size)
+	}
+	auth := MessageAuthData{SrcID: fromID}
+	head, err := NewHeader(FlagMessage, auth.Encode())
+	if err != nil {
+		return head, nil, err
 	}
+	// Fill message ciphertext buffer with random bytes.
+	msgct := make([]byte, size-sizeofStaticPacketData-len(head.AuthData))
+	crand.Read(msgct)
+	return head, msgct, nil
+}
 
-	// Encode auth data.
-	auth := messageAuthData{SrcID: fromID}
-	if _, err := crand.Read(head.Nonce[:]); err != nil {
-		return head, nil, fmt.Errorf("can't get random data: %v", err)
+// GenWhoareyouPacket generates a WHOAREYOU packet answering the packet with
+// the given nonce. The ID nonce is random. recordSeq is the seq of the record
+// of the other node which we know, or zero if we don't know it.
+func GenWhoareyouPacket(nonce v5wire.Nonce, recordSeq uint64) (v5wire.Header, error) {
+	auth := WhoareyouAuthData{RecordSeq: recordSeq}
+	if _, err := crand.Read(auth.IDNonce[:]); err != nil {
+		return v5wire.Header{}, fmt.Errorf("can't get random data: %v", err)
 	}
+	head, err := NewHeader(FlagWhoareyou, auth.Encode())
+	head.Nonce = nonce
+	return head, err
+}
 
-	var headbuf bytes.Buffer // packet header
-	binary.Write(&headbuf, binary.BigEndian, auth)
-	head.AuthData = headbuf.Bytes()
+// HeaderData returns the unmasked header of the packet. It is used as the
+// associated data of the message encryption and as the challenge data of
+// WHOAREYOU packets.
+func HeaderData(head *v5wire.Header) []byte {
+	var buf bytes.Buffer
+	buf.Write(head.IV[:])
+	binary.Write(&buf, binary.BigEndian, &head.StaticHeader)
+	buf.Write(head.AuthData)
+	return buf.Bytes()
+}
 
-	var msgctbuf []byte // message data ciphertext
-	// Fill message ciphertext buffer with random bytes.
-	msgctbuf = append(msgctbuf[:0], make([]byte, randomPacketMsgSize)...)
-	crand.Read(msgctbuf)
-	// Generate masking IV.
-	crand.Read(head.IV[:])
+func DecodeMessageAuthData(head *v5wire.Header) (MessageAuthData, error) {
+	var auth MessageAuthData
+	if head.Flag != FlagMessage {
+		return auth, ErrInvalidFlag
+	}
+	if len(head.AuthData) != sizeofMessageAuthData {
+		return auth, fmt.Errorf("%w %d for message packet", ErrInvalidAuthSize, len(head.AuthData))
+	}
+	var reader bytes.Reader
+	reader.Reset(head.AuthData)
+	binary.Read(&reader, binary.BigEndian, &auth)
+	return auth, nil
+}
 
-	return head, msgctbuf, nil
+func DecodeHandshakeAuthData(head *v5wire.Header) (HandshakeAuthData, error) {
+	var auth HandshakeAuthData
+	if head.Flag != FlagHandshake {
+		return auth, ErrInvalidFlag
+	}
+	if len(head.AuthData) < sizeofHandshakeAuthData {
+		return auth, fmt.Errorf("%w %d for handshake", ErrInvalidAuthSize, len(head.AuthData))
+	}
+	var h handshakeAuthHeader
+	var reader bytes.Reader
+	reader.Reset(head.AuthData)
+	binary.Read(&reader, binary.BigEndian, &h)
+	auth.SrcID = h.SrcID
+
+	// Decode variable-size part.
+	var (
+		vardata   = head.AuthData[sizeofHandshakeAuthData:]
+		keyOffset = int(h.SigSize)
+		recOffset = keyOffset + int(h.PubkeySize)
+	)
+	if len(vardata) < recOffset {
+		return auth, ErrTooShort
+	}
+	auth.Signature = vardata[:keyOffset]
+	auth.Pubkey = vardata[keyOffset:recOffset]
+	auth.Record = vardata[recOffset:]
+	return auth, nil
+}
+
+// DecryptMessage decrypts and decodes the message of an ordinary message
+// packet or a handshake packet.
+func DecryptMessage(head *v5wire.Header, msgData []byte, readKey []byte) (v5wire.Packet, error) {
+	pt, err := decryptGCM(readKey, head.Nonce[:], msgData, HeaderData(head))
+	if err != nil {
+		return nil, ErrMsgDecrypt
+	}
+	if len(pt) == 0 {
+		return nil, ErrMsgTooShort
+	}
+	return v5wire.DecodeMessage(pt[0], pt[1:])
+}
+
+// GenMessagePacket generates an ordinary message packet encrypted with the
+// keys of an established session. The packet has the protocol ID of the
+// session.
+func GenMessagePacket(fromID enode.ID, keys *SessionKeys, msg v5wire.Packet) (v5wire.Header, []byte, error) {
+	auth := MessageAuthData{SrcID: fromID}
+	head, err := NewHeader(FlagMessage, auth.Encode())
+	if err != nil {
+		return head, nil, err
+	}
+	if keys.ProtocolID != ([6]byte{}) {
+		head.ProtocolID = keys.ProtocolID
+	}
+	msgct, err := sealMessage(&head, keys, msg)
+	return head, msgct, err
+}
+
+// GenHandshakePacket generates a handshake packet answering the WHOAREYOU
+// challenge sent by the node. The local node record is included if the
+// challenge shows that the node has an older one. The message is encrypted
+// with the new session keys which are also returned. The packet has the
+// protocol ID of the challenge.
+func GenHandshakePacket(key *ecdsa.PrivateKey, local *enode.Node, nd *enode.Node, challenge *v5wire.Header, msg v5wire.Packet) (v5wire.Header, []byte, *SessionKeys, error) {
+	var head v5wire.Header
+	auth, err := DecodeWhoareyouAuthData(challenge)
+	if err != nil {
+		return head, nil, nil, err
+	}
+	cdata := HeaderData(challenge)
+
+	var remotePubkey = new(ecdsa.PublicKey)
+	if err := nd.Load((*enode.Secp256k1)(remotePubkey)); err != nil {
+		return head, nil, nil, fmt.Errorf("can't find secp256k1 key for recipient")
+	}
+	// Create the ephemeral key. This needs to be first because the key is part
+	// of the ID nonce signature.
+	ephkey, err := crypto.GenerateKey()
+	if err != nil {
+		return head, nil, nil, fmt.Errorf("can't generate ephemeral key")
+	}
+	ephpubkey := crypto.CompressPubkey(&ephkey.PublicKey)
+	idsig, err := makeIDSignature(key, cdata, ephpubkey, nd.ID())
+	if err != nil {
+		return head, nil, nil, fmt.Errorf("can't sign: %v", err)
+	}
+	// Add our record if it's newer than what the remote side has.
+	var record []byte
+	if auth.RecordSeq < local.Seq() {
+		record, _ = rlp.EncodeToBytes(local.Record())
+	}
+	keys := deriveKeys(ephkey, remotePubkey, local.ID(), nd.ID(), cdata)
+	if keys == nil {
+		return head, nil, nil, fmt.Errorf("key derivation failed")
+	}
+
+	hauth := HandshakeAuthData{
+		SrcID:     local.ID(),
+		Signature: idsig,
+		Pubkey:    ephpubkey,
+		Record:    record,
+	}
+	head, err = NewHeader(FlagHandshake, hauth.Encode())
+	if err != nil {
+		return head, nil, nil, err
+	}
+	head.ProtocolID = challenge.ProtocolID
+	keys.ProtocolID = challenge.ProtocolID
+	msgct, err := sealMessage(&head, keys, msg)
+	return head, msgct, keys, err
+}
+
+// RecipientKeys derives the session keys of the recipient of the handshake
+// packet, which are needed to decrypt the message in it and the messages
+// after it. challenge is the header data of the WHOAREYOU packet which the
+// recipient sent and the handshake answers.
+func RecipientKeys(key *ecdsa.PrivateKey, localID enode.ID, auth *HandshakeAuthData, challenge []byte) (*SessionKeys, error) {
+	ephkey, err := crypto.DecompressPubkey(auth.Pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %v", err)
+	}
+	keys := deriveKeys(key, ephkey, auth.SrcID, localID, challenge)
+	if keys == nil {
+		return nil, fmt.Errorf("key derivation failed")
+	}
+	// The keys are derived as the initiator's, so swap them.
+	keys.WriteKey, keys.ReadKey = keys.ReadKey, keys.WriteKey
+	return keys, nil
+}
+
+// sealMessage encrypts the message with the header as the associated data.
+func sealMessage(head *v5wire.Header, keys *SessionKeys, msg v5wire.Packet) ([]byte, error) {
+	var msgbuf bytes.Buffer
+	msgbuf.WriteByte(msg.Kind())
+	if err := rlp.Encode(&msgbuf, msg); err != nil {
+		return nil, err
+	}
+	return encryptGCM(keys.WriteKey, head.Nonce[:], msgbuf.Bytes(), HeaderData(head))
 }
@@ -0,0 +1,321 @@
+package wire
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+var (
+	testFromID = enode.HexID("a448f24c6d18e575453db13171562b71999873db5b286df957af199ec94617f7")
+	testToID   = enode.HexID("bbbb9d047f0488c0b5a93c1c3f2d8bafc7c8ff337024a55434a0d0555de64db9")
+)
+
+func randomPacket(t testing.TB) ([]byte, v5wire.Header) {
+	head, msgData, err := GenRandomPacket(testFromID, testToID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := EncodeRawPacket(testToID, head, msgData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded, head
+}
+
+func TestEncodeDecodeRawPacket(t *testing.T) {
+	encoded, head := randomPacket(t)
+	got, msgData, err := DecodeRawPacket(encoded, testToID)
+	if err != nil {
+		t.Fatalf("DecodeRawPacket returns an error: %v", err)
+	}
+	if got.StaticHeader != head.StaticHeader || got.IV != head.IV {
+		t.Errorf("wrong header: got %+v, want %+v", got.StaticHeader, head.StaticHeader)
+	}
+	auth, err := DecodeMessageAuthData(got)
+	if err != nil {
+		t.Fatalf("DecodeMessageAuthData returns an error: %v", err)
+	}
+	if auth.SrcID != testFromID {
+		t.Errorf("wrong source ID: got %v, want %v", auth.SrcID, testFromID)
+	}
+	if len(msgData) != randomPacketMsgSize {
+		t.Errorf("wrong message size: got %d, want %d", len(msgData), randomPacketMsgSize)
+	}
+}
+
+func TestGenRandomPacketSize(t *testing.T) {
+	if want := sizeofStaticPacketData + sizeofMessageAuthData; sizeofMessageHeader != want {
+		t.Fatalf("wrong message header size: got %d, want %d", sizeofMessageHeader, want)
+	}
+	for _, size := range []int{MinRandomPacketSize, RandomPacketSize, MaxPacketSize} {
+		head, msgData, err := GenRandomPacketSize(testFromID, testToID, size)
+		if err != nil {
+			t.Fatalf("GenRandomPacketSize(%d) returns an error: %v", size, err)
+		}
+		encoded, err := EncodeRawPacket(testToID, head, msgData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encoded) != size {
+			t.Errorf("wrong packet size: got %d, want %d", len(encoded), size)
+		}
+	}
+	if _, _, err := GenRandomPacketSize(testFromID, testToID, MaxPacketSize+1); err == nil {
+		t.Errorf("GenRandomPacketSize accepts a packet larger than %d bytes", MaxPacketSize)
+	}
+}
+
+func TestDecodeRawPacketWrongID(t *testing.T) {
+	encoded, _ := randomPacket(t)
+	if _, _, err := DecodeRawPacket(encoded, testFromID); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("DecodeRawPacket returns %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestDecodeRawPacketProtocol(t *testing.T) {
+	protocolID, err := ParseProtocolID("portal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, msgData, err := GenRandomPacket(testFromID, testToID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.ProtocolID = protocolID
+	encoded, err := EncodeRawPacket(testToID, head, msgData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The input is unmasked in place.
+	if _, _, err := DecodeRawPacket(append([]byte{}, encoded...), testToID); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("DecodeRawPacket returns %v, want %v", err, ErrInvalidHeader)
+	}
+	got, _, err := DecodeRawPacketProtocol(encoded, testToID, protocolID)
+	if err != nil {
+		t.Fatalf("DecodeRawPacketProtocol returns an error: %v", err)
+	}
+	if got.ProtocolID != protocolID {
+		t.Errorf("wrong protocol ID: got %q, want %q", got.ProtocolID[:], protocolID[:])
+	}
+}
+
+func TestParseProtocolID(t *testing.T) {
+	if id, err := ParseProtocolID("discv5"); err != nil || id != DefaultProtocolID() {
+		t.Errorf("ParseProtocolID(\"discv5\") = %q, %v", id[:], err)
+	}
+	for _, s := range []string{"", "discv", "discv55"} {
+		if _, err := ParseProtocolID(s); err == nil {
+			t.Errorf("ParseProtocolID(%q) doesn't return an error", s)
+		}
+	}
+}
+
+func TestHandshakeProtocolID(t *testing.T) {
+	localKey, ln := testNode(t)
+	_, nd := testNode(t)
+
+	challenge, err := GenWhoareyouPacket(v5wire.Nonce{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(challenge.ProtocolID[:], "portal")
+	head, _, keys, err := GenHandshakePacket(localKey, ln, nd, &challenge, &v5wire.Ping{})
+	if err != nil {
+		t.Fatalf("GenHandshakePacket returns an error: %v", err)
+	}
+	if head.ProtocolID != challenge.ProtocolID {
+		t.Errorf("wrong protocol ID of the handshake: got %q", head.ProtocolID[:])
+	}
+	// The messages after the handshake use the protocol ID of the session.
+	head, _, err = GenMessagePacket(ln.ID(), keys, &v5wire.Ping{})
+	if err != nil {
+		t.Fatalf("GenMessagePacket returns an error: %v", err)
+	}
+	if head.ProtocolID != challenge.ProtocolID {
+		t.Errorf("wrong protocol ID of the message: got %q", head.ProtocolID[:])
+	}
+}
+
+// testNode creates a key and a signed record of a node.
+func testNode(t testing.TB) (*ecdsa.PrivateKey, *enode.Node) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r enr.Record
+	r.Set(enr.IPv4{127, 0, 0, 1})
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, nd
+}
+
+func TestRecipientKeys(t *testing.T) {
+	localKey, ln := testNode(t)
+	remoteKey, nd := testNode(t)
+
+	// The remote node challenges us and we answer with a FINDNODE.
+	challenge, err := GenWhoareyouPacket(v5wire.Nonce{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findnode := &v5wire.Findnode{ReqID: []byte{1}, Distances: []uint{256}}
+	head, msgData, keys, err := GenHandshakePacket(localKey, ln, nd, &challenge, findnode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := DecodeHandshakeAuthData(&head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rkeys, err := RecipientKeys(remoteKey, nd.ID(), &auth, HeaderData(&challenge))
+	if err != nil {
+		t.Fatalf("RecipientKeys returns an error: %v", err)
+	}
+	if !bytes.Equal(rkeys.ReadKey, keys.WriteKey) || !bytes.Equal(rkeys.WriteKey, keys.ReadKey) {
+		t.Fatal("the keys of the recipient don't match the keys of the initiator")
+	}
+	msg, err := DecryptMessage(&head, msgData, rkeys.ReadKey)
+	if err != nil {
+		t.Fatalf("DecryptMessage returns an error: %v", err)
+	}
+	if got, ok := msg.(*v5wire.Findnode); !ok || len(got.Distances) != 1 || got.Distances[0] != 256 {
+		t.Errorf("wrong message: %+v", msg)
+	}
+}
+
+func whoareyouHeader(t testing.TB, authData []byte) *v5wire.Header {
+	head, err := NewHeader(FlagWhoareyou, authData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &head
+}
+
+func TestDecodeWhoareyouAuthData(t *testing.T) {
+	want := WhoareyouAuthData{RecordSeq: 42}
+	copy(want.IDNonce[:], "0123456789abcdef")
+
+	got, err := DecodeWhoareyouAuthData(whoareyouHeader(t, want.Encode()))
+	if err != nil {
+		t.Fatalf("DecodeWhoareyouAuthData returns an error: %v", err)
+	}
+	if got != want {
+		t.Errorf("wrong auth data: got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeAuthDataErrors(t *testing.T) {
+	head := whoareyouHeader(t, make([]byte, sizeofWhoareyouAuthData-1))
+	if _, err := DecodeWhoareyouAuthData(head); !errors.Is(err, ErrInvalidAuthSize) {
+		t.Errorf("DecodeWhoareyouAuthData returns %v, want %v", err, ErrInvalidAuthSize)
+	}
+	if _, err := DecodeMessageAuthData(head); !errors.Is(err, ErrInvalidFlag) {
+		t.Errorf("DecodeMessageAuthData returns %v, want %v", err, ErrInvalidFlag)
+	}
+}
+
+func TestGenWhoareyouPacket(t *testing.T) {
+	var nonce v5wire.Nonce
+	copy(nonce[:], "0123456789ab")
+	head, err := GenWhoareyouPacket(nonce, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := EncodeRawPacket(testToID, head, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, msgData, err := DecodeRawPacket(encoded, testToID)
+	if err != nil {
+		t.Fatalf("DecodeRawPacket returns an error: %v", err)
+	}
+	if got.Nonce != nonce || len(msgData) != 0 {
+		t.Errorf("wrong packet: nonce %x, %d bytes of message", got.Nonce, len(msgData))
+	}
+	auth, err := DecodeWhoareyouAuthData(got)
+	if err != nil {
+		t.Fatalf("DecodeWhoareyouAuthData returns an error: %v", err)
+	}
+	if auth.RecordSeq != 7 {
+		t.Errorf("wrong record seq: got %d, want 7", auth.RecordSeq)
+	}
+}
+
+func TestHandshakeAuthDataEncode(t *testing.T) {
+	want := HandshakeAuthData{
+		SrcID:     testFromID,
+		Signature: bytes.Repeat([]byte{1}, 64),
+		Pubkey:    bytes.Repeat([]byte{2}, 33),
+		Record:    []byte{3, 4, 5},
+	}
+	head, err := NewHeader(FlagHandshake, want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeHandshakeAuthData(&head)
+	if err != nil {
+		t.Fatalf("DecodeHandshakeAuthData returns an error: %v", err)
+	}
+	if got.SrcID != want.SrcID || !bytes.Equal(got.Signature, want.Signature) ||
+		!bytes.Equal(got.Pubkey, want.Pubkey) || !bytes.Equal(got.Record, want.Record) {
+		t.Errorf("wrong auth data: got %+v, want %+v", got, want)
+	}
+}
+
+func FuzzDecodeRawPacket(f *testing.F) {
+	encoded, _ := randomPacket(f)
+	f.Add(encoded)
+	f.Add(encoded[:sizeofStaticPacketData])
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, input []byte) {
+		// The input is unmasked in place.
+		head, msgData, err := DecodeRawPacket(append([]byte{}, input...), testToID)
+		if err != nil {
+			return
+		}
+		if len(head.AuthData) != int(head.AuthSize) {
+			t.Errorf("auth data has %d bytes, but auth size is %d", len(head.AuthData), head.AuthSize)
+		}
+		if sizeofStaticPacketData+len(head.AuthData)+len(msgData) != len(input) {
+			t.Errorf("decoded parts don't add up to the input length %d", len(input))
+		}
+		if head.ProtocolID != DefaultProtocolID() || head.Version < minVersion {
+			t.Errorf("invalid static header is accepted: %+v", head.StaticHeader)
+		}
+	})
+}
+
+func FuzzDecodeWhoareyouAuthData(f *testing.F) {
+	f.Add(make([]byte, sizeofWhoareyouAuthData), byte(FlagWhoareyou))
+	f.Add([]byte{}, byte(FlagWhoareyou))
+	f.Add(make([]byte, sizeofMessageAuthData), byte(FlagMessage))
+	f.Fuzz(func(t *testing.T, authData []byte, flag byte) {
+		head := whoareyouHeader(t, authData)
+		head.Flag = flag
+		auth, err := DecodeWhoareyouAuthData(head)
+		if err != nil {
+			return
+		}
+		if flag != FlagWhoareyou || len(authData) != sizeofWhoareyouAuthData {
+			t.Errorf("invalid auth data is accepted: flag=%d len=%d", flag, len(authData))
+		}
+		// The decoded auth data must encode back to the same bytes.
+		if encoded := auth.Encode(); !bytes.Equal(encoded, authData) {
+			t.Errorf("auth data doesn't round-trip: got %x, want %x", encoded, authData)
+		}
+	})
+}